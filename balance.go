@@ -0,0 +1,160 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNoHealthyMember is set as the chain error by a Balancer if no
+	// member is available to serve the request.
+	ErrNoHealthyMember = ErrChainer.Wrap("no healthy balancer member")
+	// ErrInvalidMember is returned when an invalid member name is specified.
+	ErrInvalidMember = ErrChainer.WrapFormat("no balancer member named '%s'")
+)
+
+// BalancePolicy defines how a Balancer chooses a member.
+type BalancePolicy int
+
+const (
+	// RoundRobin chooses members in turn.
+	RoundRobin BalancePolicy = iota
+	// WeightedRandom chooses members randomly with probability
+	// proportional to their weight.
+	WeightedRandom
+)
+
+// HealthChecker is optionally implemented by Balancer members.
+// Members whose Healthy returns false are not chosen.
+type HealthChecker interface {
+	Healthy() bool
+}
+
+// WeightedHandler is a Balancer member.
+type WeightedHandler struct {
+	// Name is the member name, unique in a Balancer.
+	Name string
+	// Handler is the member handler.
+	Handler http.Handler
+	// Weight is the member weight. Members with a weight less than 1
+	// are not chosen.
+	Weight int
+}
+
+// Balancer is a handler that spreads requests across multiple members.
+type Balancer struct {
+	next    uint64
+	name    string
+	policy  BalancePolicy
+	members []WeightedHandler
+	weights []int64
+}
+
+// Balance returns a Balancer registered in a chain under name that serves
+// each request using one of members chosen by policy, skipping members
+// that implement HealthChecker and report as unhealthy. The chosen member
+// is recorded in the chain trace as "name→member" and its executions in
+// Stats and, if enabled, Counts under the same entry.
+//
+// If no member is available the Balancer responds with
+// 503 Service Unavailable and sets ErrNoHealthyMember as the chain error.
+func Balance(name string, members []WeightedHandler, policy BalancePolicy) *Balancer {
+	p := &Balancer{
+		name:    name,
+		policy:  policy,
+		members: append([]WeightedHandler(nil), members...),
+		weights: make([]int64, len(members)),
+	}
+	for i, member := range members {
+		p.weights[i] = int64(member.Weight)
+	}
+	return p
+}
+
+// SetWeight atomically sets the weight of a member.
+// If member does not exist ErrInvalidMember sibling is returned.
+func (b *Balancer) SetWeight(member string, w int) error {
+	for i := range b.members {
+		if b.members[i].Name == member {
+			atomic.StoreInt64(&b.weights[i], int64(w))
+			return nil
+		}
+	}
+	return ErrInvalidMember.WrapArgs(member)
+}
+
+// ServeHTTP implements http.Handler.
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	chain, exists := FromContext(r.Context())
+	i := b.choose()
+	if i < 0 {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		if exists {
+			chain.SetError(ErrNoHealthyMember)
+		}
+		return
+	}
+	if !exists {
+		b.members[i].Handler.ServeHTTP(w, r)
+		return
+	}
+	entry := b.name + "→" + b.members[i].Name
+	chain.annotateTrace(entry)
+	start := time.Now()
+	b.members[i].Handler.ServeHTTP(w, r)
+	chain.recordEntry(entry, time.Since(start))
+}
+
+// available returns the weight of member at index i or 0 if the member
+// is unavailable.
+func (b *Balancer) available(i int) int64 {
+	weight := atomic.LoadInt64(&b.weights[i])
+	if weight < 1 {
+		return 0
+	}
+	if checker, ok := b.members[i].Handler.(HealthChecker); ok && !checker.Healthy() {
+		return 0
+	}
+	return weight
+}
+
+// choose returns the index of the chosen member or -1 if none available.
+func (b *Balancer) choose() int {
+	n := len(b.members)
+	if n == 0 {
+		return -1
+	}
+	if b.policy == WeightedRandom {
+		weights := make([]int64, n)
+		total := int64(0)
+		for i := range b.members {
+			weights[i] = b.available(i)
+			total += weights[i]
+		}
+		if total == 0 {
+			return -1
+		}
+		pick := rand.Int63n(total)
+		for i, weight := range weights {
+			if pick < weight {
+				return i
+			}
+			pick -= weight
+		}
+		return -1
+	}
+	start := int(atomic.AddUint64(&b.next, 1) % uint64(n))
+	for j := 0; j < n; j++ {
+		i := (start + j) % n
+		if b.available(i) > 0 {
+			return i
+		}
+	}
+	return -1
+}
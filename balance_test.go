@@ -0,0 +1,118 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testMember struct {
+	calls   int
+	healthy bool
+}
+
+func (tm *testMember) ServeHTTP(w http.ResponseWriter, r *http.Request) { tm.calls++ }
+
+func (tm *testMember) Healthy() bool { return tm.healthy }
+
+func makeBalancedChain(policy BalancePolicy, weights ...int) (*Chain, *Balancer, []*testMember) {
+	var members []*testMember
+	var handlers []WeightedHandler
+	for i, weight := range weights {
+		member := &testMember{healthy: true}
+		members = append(members, member)
+		handlers = append(handlers, WeightedHandler{
+			Name:    string(rune('a' + i)),
+			Handler: member,
+			Weight:  weight,
+		})
+	}
+	b := Balance("lb", handlers, policy)
+	c := New(testkey)
+	c.Append("lb", b)
+	return c, b, members
+}
+
+func TestBalanceRoundRobin(t *testing.T) {
+
+	c, _, members := makeBalancedChain(RoundRobin, 1, 1, 1)
+	for i := 0; i < 300; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	for _, member := range members {
+		if member.calls != 100 {
+			t.Fatal("RoundRobin failed")
+		}
+	}
+}
+
+func TestBalanceWeightedRandom(t *testing.T) {
+
+	const requests = 4000
+
+	c, b, members := makeBalancedChain(WeightedRandom, 3, 1)
+	for i := 0; i < requests; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	ratio := float64(members[0].calls) / float64(members[1].calls)
+	if ratio < 2.5 || ratio > 3.5 {
+		t.Fatalf("WeightedRandom failed, ratio %f", ratio)
+	}
+
+	if err := b.SetWeight("c", 1); !errors.Is(err, ErrInvalidMember) {
+		t.Fatal("SetWeight() failed")
+	}
+	if err := b.SetWeight("a", 0); err != nil {
+		t.Fatal(err)
+	}
+	members[1].calls = 0
+	for i := 0; i < 100; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	if members[1].calls != 100 {
+		t.Fatal("SetWeight() failed")
+	}
+}
+
+func TestBalanceHealth(t *testing.T) {
+
+	c, _, members := makeBalancedChain(RoundRobin, 1, 1)
+	members[0].healthy = false
+	for i := 0; i < 10; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	if members[0].calls != 0 || members[1].calls != 10 {
+		t.Fatal("Balance() failed to skip unhealthy member")
+	}
+	if trace := c.LastRun().Trace; len(trace) != 1 || trace[0] != "lb→b" {
+		t.Fatal("Balance() failed to annotate trace")
+	}
+
+	members[1].healthy = false
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusServiceUnavailable || !errors.Is(c.LastError(), ErrNoHealthyMember) {
+		t.Fatal("Balance() failed with no healthy members")
+	}
+}
+
+func TestBalanceStats(t *testing.T) {
+
+	c, _, _ := makeBalancedChain(RoundRobin, 1, 1)
+	WithCounters()(c)
+	for i := 0; i < 4; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	stats, counts := c.Stats(), c.Counts()
+	if stats["lb→a"].CallCount != 2 || stats["lb→b"].CallCount != 2 || stats["lb"].CallCount != 4 {
+		t.Fatal("Balancer failed to record member stats")
+	}
+	if counts["lb→a"] != 2 || counts["lb→b"] != 2 || counts["lb"] != 4 {
+		t.Fatal("Balancer failed to count member executions")
+	}
+}
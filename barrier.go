@@ -0,0 +1,64 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+// ErrBarrierViolation is returned by MoveTo if the chain was created with
+// WithStrictBarriers and the move would skip a barrier.
+var ErrBarrierViolation = ErrChainer.WrapFormat("move to '%s' would skip barrier '%s'")
+
+// WithStrictBarriers makes MoveTo reject moves that would skip a barrier
+// with ErrBarrierViolation instead of moving to the barrier.
+func WithStrictBarriers() Option {
+	return func(c *Chain) { c.strictbar = true }
+}
+
+// MarkBarrier marks a handler registered under name as a barrier, i.e. a
+// handler that cannot be skipped by a forward MoveTo, for handlers such
+// as authentication or input validation.
+//
+// If a handler moves execution forward past a barrier not yet executed
+// in the current run, execution continues on the barrier instead, or the
+// move is rejected if the chain was created with WithStrictBarriers.
+// Moves backward and past barriers already executed in the current run
+// are not affected. If name is not registered ErrInvalidName sibling is
+// returned.
+func (c *Chain) MarkBarrier(name string) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(name)
+	}
+	c.barriers[key] = true
+	return nil
+}
+
+// IsBarrier returns true if the handler registered under name is marked
+// as a barrier.
+func (c *Chain) IsBarrier(name string) bool {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return c.barriers[c.normalize(name)]
+}
+
+// barrierBefore returns the name of the first barrier not yet executed in
+// the current run that a move from the current handler to the handler
+// registered under target would skip or an empty string if there is none.
+// varmu must be locked by the caller.
+func (c *Chain) barrierBefore(target string) string {
+	if len(c.barriers) == 0 || c.current == "" {
+		return ""
+	}
+	for i := c.names[c.current] + 1; i < c.names[target]; i++ {
+		if name := c.indexes[i]; c.barriers[name] && !c.passed[name] {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMarkBarrier(t *testing.T) {
+
+	const want = "Handler 'auth' reporting in.\nHandler 'validate' reporting in.\nHandler 'serve' reporting in.\n"
+	c := New(testkey)
+	c.Append("skip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.MoveTo("serve"); err != nil {
+			t.Fatal("MoveTo() failed")
+		}
+	}))
+	c.Append("auth", MakeHandler("auth"))
+	c.Append("validate", MakeHandler("validate"))
+	c.Append("serve", MakeHandler("serve"))
+	if err := c.MarkBarrier("nope"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("MarkBarrier() failed")
+	}
+	c.MarkBarrier("auth")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want {
+		t.Fatalf("MarkBarrier() failed: %s", rec.Body.String())
+	}
+}
+
+func TestMarkBarrierBackward(t *testing.T) {
+
+	const want = "Handler 'auth' reporting in.\nHandler 'serve' reporting in.\nHandler 'final' reporting in.\n"
+	visits := 0
+	c := New(testkey)
+	c.Append("start", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Barrier already executed in this run does not re-trigger.
+		if visits++; visits > 1 {
+			c.MoveTo("final")
+		}
+	}))
+	c.Append("auth", MakeHandler("auth"))
+	c.Append("serve", MakeHandler("serve"))
+	c.Append("loop", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.MoveTo("start")
+	}))
+	c.Append("final", MakeHandler("final"))
+	c.MarkBarrier("auth")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want || visits != 2 {
+		t.Fatalf("MarkBarrier() failed: %s", rec.Body.String())
+	}
+}
+
+func TestStrictBarriers(t *testing.T) {
+
+	var moveErr error
+	c := New(testkey, WithStrictBarriers())
+	c.Append("skip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		moveErr = c.MoveTo("serve")
+	}))
+	c.Append("auth", MakeHandler("auth"))
+	c.Append("serve", MakeHandler("serve"))
+	c.MarkBarrier("auth")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if !errors.Is(moveErr, ErrBarrierViolation) {
+		t.Fatal("WithStrictBarriers() failed")
+	}
+	if rec.Body.String() != "Handler 'auth' reporting in.\nHandler 'serve' reporting in.\n" {
+		t.Fatal("WithStrictBarriers() failed")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// BodyReplayer is optionally implemented by chain handlers that need to
+// read the request body more than once, for instance to retry a request.
+type BodyReplayer interface {
+	// NeedsBodyReplay returns true if the handler reads the request body
+	// using ReplayBody.
+	NeedsBodyReplay() bool
+}
+
+// WithBodyBuffer enables buffering of request bodies in memory, up to
+// maxBytes, for runs of chains containing a handler that implements
+// BodyReplayer and needs body replay. The body is read before the first
+// handler is executed and r.Body is replaced by a reader of the buffer.
+// Handlers obtain further fresh readers of the body using ReplayBody.
+// If the body exceeds maxBytes no handler is executed and ErrBodyTooLarge
+// sibling is set as the chain error. A value less than 1 disables
+// buffering.
+func WithBodyBuffer(maxBytes int64) Option {
+	return func(c *Chain) { c.bodymax = maxBytes }
+}
+
+// bodyKey is the context key for a buffered request body.
+type bodyKey struct{}
+
+// ReplayBody returns a fresh reader of the request body of r buffered by
+// a chain configured with WithBodyBuffer or r.Body if the body was not
+// buffered.
+func ReplayBody(r *http.Request) io.ReadCloser {
+	if body, ok := r.Context().Value(bodyKey{}).([]byte); ok {
+		return io.NopCloser(bytes.NewReader(body))
+	}
+	return r.Body
+}
+
+// bufferBody returns r with its body buffered for replay if body
+// buffering is enabled, the body was not already buffered by a parent
+// chain and a handler in the chain needs body replay.
+// runmu must be locked by the caller.
+func (c *Chain) bufferBody(r *http.Request) (*http.Request, error) {
+	if c.bodymax < 1 || r.Body == nil || r.Body == http.NoBody {
+		return r, nil
+	}
+	if _, ok := r.Context().Value(bodyKey{}).([]byte); ok {
+		return r, nil
+	}
+	needed := false
+	for _, link := range c.links {
+		if replayer, ok := link.(BodyReplayer); ok && replayer.NeedsBodyReplay() {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return r, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, c.bodymax+1))
+	r.Body.Close()
+	if err != nil {
+		return r, err
+	}
+	r = r.WithContext(context.WithValue(r.Context(), bodyKey{}, body))
+	r.Body = ReplayBody(r)
+	if int64(len(body)) > c.bodymax {
+		return r, ErrBodyTooLarge.WrapArgs(c.bodymax)
+	}
+	return r, nil
+}
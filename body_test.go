@@ -0,0 +1,72 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// retryHandler reads the request body on every attempt.
+type retryHandler struct {
+	attempts int
+	bodies   []string
+}
+
+func (rh *retryHandler) NeedsBodyReplay() bool { return true }
+
+func (rh *retryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for i := 0; i < rh.attempts; i++ {
+		body := ReplayBody(r)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		rh.bodies = append(rh.bodies, string(data))
+	}
+}
+
+func TestBodyBuffer(t *testing.T) {
+
+	var first string
+	rh := &retryHandler{attempts: 2}
+	c := New(testkey, WithBodyBuffer(16))
+	c.Append("first", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		first = string(data)
+	}))
+	c.Append("retry", rh)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	c.ServeHTTP(httptest.NewRecorder(), req)
+	if c.LastError() != nil || first != "payload" {
+		t.Fatal("WithBodyBuffer() failed")
+	}
+	if len(rh.bodies) != 2 || rh.bodies[0] != "payload" || rh.bodies[1] != "payload" {
+		t.Fatal("ReplayBody() failed")
+	}
+
+	rh.bodies = nil
+	req = httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 17)))
+	c.ServeHTTP(httptest.NewRecorder(), req)
+	if !errors.Is(c.LastError(), ErrBodyTooLarge) || len(rh.bodies) != 0 {
+		t.Fatal("WithBodyBuffer() failed to limit body")
+	}
+
+	// Without a handler needing replay the body is passed through.
+	c = New(testkey, WithBodyBuffer(16))
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(bodyKey{}).([]byte); ok {
+			t.Fatal("WithBodyBuffer() failed, body buffered")
+		}
+	}))
+	req = httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 17)))
+	c.ServeHTTP(httptest.NewRecorder(), req)
+	if c.LastError() != nil {
+		t.Fatal("WithBodyBuffer() failed")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is set as the chain error by a CircuitBreaker while it is
+// open.
+var ErrCircuitOpen = ErrChainer.Wrap("circuit open")
+
+// circuitBreaker is a circuit breaker handler.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// CircuitBreaker returns a handler that protects handlers following it in
+// a chain. It observes the chain error after the chain finishes and opens
+// once threshold consecutive requests finished with an error.
+//
+// While open it responds with 503 Service Unavailable and sets
+// ErrCircuitOpen as the chain error so that protected handlers are not
+// executed. After cooldown elapses requests are let through again and the
+// first one that finishes without an error closes the circuit while one
+// that finishes with an error opens it for another cooldown.
+//
+// The returned handler is safe for concurrent use and may be shared
+// between chains. It does nothing if executed outside of a chain.
+func CircuitBreaker(threshold int, cooldown time.Duration) http.Handler {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		mu:        sync.Mutex{},
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (cb *circuitBreaker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	chain, exists := FromContext(r.Context())
+	if !exists {
+		return
+	}
+	if cb.isOpen() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		chain.SetError(ErrCircuitOpen)
+		return
+	}
+	chain.afterRun(cb.observe)
+}
+
+// isOpen returns true if the circuit is open.
+func (cb *circuitBreaker) isOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.failures >= cb.threshold && time.Since(cb.openedAt) < cb.cooldown
+}
+
+// observe records the outcome of a protected request.
+func (cb *circuitBreaker) observe(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err == nil {
+		cb.failures = 0
+		return
+	}
+	if cb.failures++; cb.failures >= cb.threshold {
+		cb.openedAt = time.Now()
+	}
+}
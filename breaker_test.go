@@ -0,0 +1,55 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+
+	const cooldown = 50 * time.Millisecond
+
+	fail := true
+	calls := 0
+	c := New(testkey)
+	c.Append("breaker", CircuitBreaker(3, cooldown))
+	c.Append("protected", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			chain, _ := Unpack(r, testkey)
+			chain.SetError(errors.New("protected handler failure"))
+		}
+	}))
+
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, MakeRequest("/"))
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		serve()
+	}
+	if code := serve(); code != http.StatusServiceUnavailable || calls != 3 {
+		t.Fatal("CircuitBreaker() failed to open")
+	}
+	if !errors.Is(c.LastError(), ErrCircuitOpen) {
+		t.Fatal("CircuitBreaker() failed to set error")
+	}
+
+	time.Sleep(cooldown)
+	fail = false
+	if code := serve(); code != http.StatusOK || calls != 4 {
+		t.Fatal("CircuitBreaker() failed to recover")
+	}
+	if code := serve(); code != http.StatusOK || calls != 5 {
+		t.Fatal("CircuitBreaker() failed to close")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// BufferedChain is a http.Handler that serves a Chain into a buffer and
+// commits the response only if the chain finished without an error so
+// that clients never receive a partially written response of a failed
+// run.
+type BufferedChain struct {
+	chain *Chain
+}
+
+// NewBufferedChain returns a new BufferedChain that serves c.
+func NewBufferedChain(c *Chain) *BufferedChain {
+	return &BufferedChain{chain: c}
+}
+
+// Chain returns the chain served by b.
+func (b *BufferedChain) Chain() *Chain { return b.chain }
+
+// ServeHTTP serves the chain into a buffer. If the chain finished without
+// an error the buffered header, status code and body are written to w.
+//
+// If the chain finished with an error the buffer is discarded and the
+// error handler set on the chain by SetErrorHandler is called with w.
+// If the error handler already wrote the error response during the run,
+// because no handler wrote anything before the error, that response is
+// written to w instead. If no error handler is set, a plain 500 Internal
+// Server Error response is written.
+//
+// Because the response is buffered, handlers that flush or stream the
+// response are not served incrementally.
+func (b *BufferedChain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := newBufferWriter()
+	out := b.chain.serve(nil, time.Time{}, rec, r)
+	if out.err == nil || out.handled {
+		copyResponse(w, rec)
+		return
+	}
+	if out.errorfunc == nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	out.errorfunc(w, r, out.err)
+}
+
+// bufferWriter is a http.ResponseWriter that buffers a response in
+// memory.
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newBufferWriter returns a new, empty bufferWriter.
+func newBufferWriter() *bufferWriter {
+	return &bufferWriter{header: make(http.Header)}
+}
+
+// Header implements http.ResponseWriter.Header.
+func (bw *bufferWriter) Header() http.Header { return bw.header }
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (bw *bufferWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+// Write implements http.ResponseWriter.Write.
+func (bw *bufferWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+// code returns the buffered status code or 200 OK if none was written.
+func (bw *bufferWriter) code() int {
+	if bw.status == 0 {
+		return http.StatusOK
+	}
+	return bw.status
+}
+
+// copyResponse writes the header, status code and body buffered by bw
+// to w.
+func copyResponse(w http.ResponseWriter, bw *bufferWriter) {
+	for key, vals := range bw.header {
+		w.Header()[key] = append([]string(nil), vals...)
+	}
+	w.WriteHeader(bw.code())
+	w.Write(bw.body.Bytes())
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestBufferedChain(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Partial", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "partial")
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	b := NewBufferedChain(c)
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusAccepted || rec.Header().Get("X-Partial") != "yes" ||
+		rec.Body.String() != "partialHandler 'h2' reporting in.\n" {
+		t.Fatal("BufferedChain failed to commit response")
+	}
+
+	c.Append("h3", MakeHandlerThatSetsAnError("h3"))
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("X-Partial") != "" {
+		t.Fatal("BufferedChain failed to discard response")
+	}
+
+	calls := 0
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		calls++
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	})
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusBadGateway || rec.Body.String() != "Handler 'h3' error.\n" || calls != 1 {
+		t.Fatal("BufferedChain failed to call error handler")
+	}
+}
+
+func TestBufferedChainUnwritten(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.SetError(errors.New("failed"))
+	}))
+	calls := 0
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		calls++
+		http.Error(w, err.Error(), http.StatusTeapot)
+	})
+	rec := httptest.NewRecorder()
+	NewBufferedChain(c).ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusTeapot || calls != 1 {
+		t.Fatal("BufferedChain failed")
+	}
+}
+
+func TestBufferedChainConcurrent(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+		if r.URL.Path == "/fail" {
+			c.SetError(errors.New("failed"))
+		}
+	}))
+	b := NewBufferedChain(c)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			b.ServeHTTP(rec, MakeRequest(path))
+			if path == "/fail" && rec.Code != http.StatusInternalServerError ||
+				path == "/ok" && (rec.Code != http.StatusOK || rec.Body.String() != "/ok") {
+				t.Errorf("BufferedChain reported result of another request for %s", path)
+			}
+		}([]string{"/ok", "/fail"}[i%2])
+	}
+	wg.Wait()
+}
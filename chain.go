@@ -6,8 +6,16 @@ package chainer
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vedranvuk/errorex"
 )
@@ -19,50 +27,751 @@ var (
 	ErrDupName = ErrChainer.WrapFormat("duplicate name '%s'")
 	// ErrInvalidName is returned when an invalid name is specified.
 	ErrInvalidName = ErrChainer.WrapFormat("no handler registered under name '%s'")
+	// ErrTooManyVars is returned when setting a variable would exceed the
+	// maximum number of variables set by WithMaxVarSize.
+	ErrTooManyVars = ErrChainer.WrapFormat("too many variables, maximum is %d")
+	// ErrMethodNotAllowed is set as the chain error when no handler was
+	// registered with AppendMethod for the request method.
+	ErrMethodNotAllowed = ErrChainer.WrapFormat("method '%s' not allowed")
+	// ErrNameCount is returned by Reorder if the number of specified names
+	// does not match the number of registered handlers.
+	ErrNameCount = ErrChainer.WrapFormat("expected %d names, got %d")
+	// ErrHandlerTimeout is set as the chain error when a write to the
+	// response fails with http.ErrHandlerTimeout.
+	ErrHandlerTimeout = ErrChainer.Wrap("response writer timed out")
+	// ErrNameCollision is returned when a name differs from a registered
+	// name but both normalize to the same name.
+	ErrNameCollision = ErrChainer.WrapFormat("name '%s' collides with registered name '%s'")
+	// ErrInvalidIndex is returned when an index is out of range.
+	ErrInvalidIndex = ErrChainer.WrapFormat("index %d out of range")
 )
 
 // Chain is a chain of http.Handlers executed in sequential order.
 type Chain struct {
+	requests  uint64
+	failures  uint64
+	teeerrs   uint64
+	latewrs   uint64
+	sinkdrop  uint64
+	inflight  int32
+	running   int32
+	disabling int32
+	gone      int32
+
 	key interface{}
 
 	runmu   sync.Mutex
 	links   []http.Handler
 	names   map[string]int
 	indexes []string
+	spells  map[string]string
+	stats   map[string]*handlerStats
+	entries map[string]string
+	marks   map[string]bool
+	methods map[string]string
+
+	onsuccess []namedHandler
+	onfailure []namedHandler
+	deferred  []namedHandler
+	errorfunc func(w http.ResponseWriter, r *http.Request, err error)
+	emptyfunc func(w http.ResponseWriter, r *http.Request)
+	wrapfunc  func(http.ResponseWriter) http.ResponseWriter
+	metrics   Metrics
+	errmap    []func(error) (int, bool)
+
+	varmu     sync.Mutex
+	vars      map[string]interface{}
+	err       error
+	next      string
+	overrides map[string]http.Handler
+	provided  map[interface{}]interface{}
+	trace     []string
+	jumps     [][2]string
+	status    int
+	statuses  map[int]*uint64
+	dropped   int
+	afterrun  []func(err error)
+	errxform  func(error) error
+	onfirst   func(err error, name string)
+	onpanic   func(name string, recovered interface{}, stack []byte)
+	ongone    func(r *http.Request, at string)
+	onerrwr   func(name string, written int64, err error)
+	errwrmin  int64
+	rec       *recorder
+	linkbytes int64
+	failed    bool
+	current   string
+	watchers  []func(op string, key string, val interface{})
+	disabled  map[string]bool
+	barriers  map[string]bool
+	passed    map[string]bool
+	linkhooks []*linkHook
+	published []string
+	sink      *errorSink
+	errpath   string
+	scope     VarScope
+	wrappers  []func(http.ResponseWriter) http.ResponseWriter
+	unwrap    []func()
+	executed  int
+	handled   bool
+	snapshots map[string]map[string]interface{}
+	ran       bool
+	sampled   bool
+
+	registries map[*Registry]string
+
+	qmu       sync.Mutex
+	quiescing bool
+	active    int
+	resume    chan struct{}
+	drained   chan struct{}
+
+	drainbody bool
+	teesel    func(*http.Request) bool
+	teesink   func(*http.Request) io.WriteCloser
+
+	tracelimit  int
+	bodymax     int64
+	sampler     func(*http.Request) bool
+	maxvars     int
+	maxdepth    int
+	strictbar   bool
+	strictjumps bool
+	strict      bool
+	recoverfn   func(recovered interface{}) error
+	jumpdecl    map[string]map[string]bool
+	clock       func() time.Time
+	observer    Observer
+	counting    bool
+	hdrdeadline time.Duration
+	counters    map[string]*int64
+	latewrite   LateWriteReaction
+	cancelerr   bool
+	cancelrun   context.CancelCauseFunc
+	runlogger   *slog.Logger
+	diaglog     Logger
+	enrichlog   func(*http.Request, *Chain) []slog.Attr
+
+	streamtrailer string
+	streamhook    func(r *http.Request, err error)
+
+	namenorm func(string) string
+	redactor func(key string, val interface{}) (interface{}, bool)
+}
 
-	varmu sync.Mutex
-	vars  map[string]interface{}
-	err   error
-	next  string
+// RequestAnnotator is implemented by handlers that attach values to the
+// request for handlers that follow them in the chain.
+//
+// If a handler in the chain implements RequestAnnotator, Annotate is
+// called after the handler's ServeHTTP returns and the returned request,
+// if not nil, is passed to subsequent handlers. Returned request should be
+// derived from r so it retains the chain in its context.
+type RequestAnnotator interface {
+	Annotate(r *http.Request) *http.Request
+}
+
+// Option is a Chain configuration option.
+type Option func(c *Chain)
+
+// WithMaxVarSize limits the number of context variables a chain can hold
+// to n. A value less than 1 means no limit.
+func WithMaxVarSize(n int) Option {
+	return func(c *Chain) { c.maxvars = n }
+}
+
+// WithVars sets initial context variables of the chain to copies of
+// values in vars. See InitVars.
+func WithVars(vars map[string]interface{}) Option {
+	return func(c *Chain) { c.initVars(vars) }
+}
+
+// WithStrict makes the chain panic with the error instead of returning it
+// when a handler is registered under a duplicate or colliding name, for
+// instance by Append, AppendSlice or Splice, and when MoveTo is called
+// with an invalid target, which surfaces misconfiguration immediately
+// during development and in tests.
+func WithStrict() Option {
+	return func(c *Chain) { c.strict = true }
 }
 
-// New creates a new Chain instance with specified context key.
-func New(key interface{}) *Chain {
+// strictErr panics with err if it is not nil and the chain was created
+// with WithStrict, otherwise it returns err.
+func (c *Chain) strictErr(err error) error {
+	if err != nil && c.strict {
+		panic(err)
+	}
+	return err
+}
+
+// WithClock sets the function the chain uses to get the current time for
+// time based features such as AppendThrottled. It defaults to time.Now
+// and is meant to be replaced with a fake clock in tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *Chain) { c.clock = now }
+}
+
+// now returns the current time as reported by the chain clock.
+func (c *Chain) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock()
+}
+
+// WithCancelOnError makes the chain serve requests with a cancellable
+// context that is cancelled, with the chain error as the cause, as soon as
+// the chain stops because of an error. Goroutines started by handlers
+// that observe the request context are thus stopped promptly.
+// Post-run handlers receive the cancelled request and can retrieve the
+// error using context.Cause.
+func WithCancelOnError() Option {
+	return func(c *Chain) { c.cancelerr = true }
+}
+
+// WithDrainBody makes the chain read any remaining request body and close
+// it after the chain finishes so that the connection can be reused.
+func WithDrainBody() Option {
+	return func(c *Chain) { c.drainbody = true }
+}
+
+// New creates a new Chain instance with specified context key
+// and optional options.
+func New(key interface{}, options ...Option) *Chain {
 	p := &Chain{
-		key:   key,
-		runmu: sync.Mutex{},
-		varmu: sync.Mutex{},
-		names: make(map[string]int),
-		vars:  make(map[string]interface{}),
+		key:       key,
+		runmu:     sync.Mutex{},
+		varmu:     sync.Mutex{},
+		names:     make(map[string]int),
+		spells:    make(map[string]string),
+		stats:     make(map[string]*handlerStats),
+		entries:   make(map[string]string),
+		marks:     make(map[string]bool),
+		methods:   make(map[string]string),
+		vars:      make(map[string]interface{}),
+		overrides: make(map[string]http.Handler),
+		provided:  make(map[interface{}]interface{}),
+		disabled:  make(map[string]bool),
+		barriers:  make(map[string]bool),
+
+		registries: make(map[*Registry]string),
+
+		tracelimit: DefaultTraceLimit,
+		observer:   NopObserver{},
+	}
+	for _, option := range options {
+		option(p)
 	}
 	return p
 }
 
+// NewFromHandlers returns a new chain with handlers appended in order as
+// specified. If a name repeats ErrDupName sibling is returned along with a
+// nil chain.
+func NewFromHandlers(key interface{}, pairs ...NamedHandler) (*Chain, error) {
+	c := New(key)
+	if err := c.AppendSlice(pairs); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // Append appends a handler to the chain under a specified name
 // which must be unique or ErrDupName sibling is returned.
 func (c *Chain) Append(name string, handler http.Handler) error {
 	c.runmu.Lock()
 	defer c.runmu.Unlock()
 
-	if _, exists := c.names[name]; exists {
-		return ErrDupName.WrapArgs(name)
+	return c.append(name, handler)
+}
+
+// append appends handler under name. runmu must be locked by the caller.
+func (c *Chain) append(name string, handler http.Handler) error {
+	key, err := c.checkName(name)
+	if err != nil {
+		return err
 	}
+	c.varmu.Lock()
 	c.links = append(c.links, handler)
-	c.names[name] = len(c.links) - 1
-	c.indexes = append(c.indexes, name)
+	c.names[key] = len(c.links) - 1
+	c.indexes = append(c.indexes, key)
+	c.spells[key] = name
+	if _, exists := c.stats[key]; !exists {
+		c.stats[key] = &handlerStats{}
+	}
+	c.varmu.Unlock()
+	return nil
+}
+
+// NamedHandler is a handler with a name.
+type NamedHandler struct {
+	// Name is the name of the handler.
+	Name string
+	// Handler is the handler.
+	Handler http.Handler
+}
+
+// AppendSlice appends handlers to the chain in slice order. If any of the
+// names is already registered or repeats in pairs ErrDupName sibling with
+// the first conflicting name is returned and the chain is not modified.
+func (c *Chain) AppendSlice(pairs []NamedHandler) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	seen := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, err := c.checkName(pair.Name)
+		if err != nil {
+			return err
+		}
+		if spelling, exists := seen[key]; exists {
+			if spelling != pair.Name {
+				return c.strictErr(ErrNameCollision.WrapArgs(pair.Name, spelling))
+			}
+			return c.strictErr(ErrDupName.WrapArgs(pair.Name))
+		}
+		seen[key] = pair.Name
+	}
+	for _, pair := range pairs {
+		c.append(pair.Name, pair.Handler)
+	}
+	return nil
+}
+
+// namedHandler is a handler with a name.
+type namedHandler struct {
+	name    string
+	handler http.Handler
+}
+
+// appendNamed appends handler under name to list and returns it or returns
+// ErrDupName sibling if name already exists in list.
+func appendNamed(list []namedHandler, name string, handler http.Handler) ([]namedHandler, error) {
+	for _, nh := range list {
+		if nh.name == name {
+			return list, ErrDupName.WrapArgs(name)
+		}
+	}
+	return append(list, namedHandler{name, handler}), nil
+}
+
+// OnSuccess registers a handler under a specified name to be executed
+// after all chain handlers if the chain finished without an error.
+// Name must be unique among success handlers or ErrDupName sibling is
+// returned. Success handlers are executed in order as they were registered.
+func (c *Chain) OnSuccess(name string, handler http.Handler) (err error) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.onsuccess, err = appendNamed(c.onsuccess, name, handler)
+	return
+}
+
+// OnFailure registers a handler under a specified name to be executed
+// after chain execution if the chain finished with an error.
+// Name must be unique among failure handlers or ErrDupName sibling is
+// returned. Failure handlers are executed in order as they were registered.
+func (c *Chain) OnFailure(name string, handler http.Handler) (err error) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.onfailure, err = appendNamed(c.onfailure, name, handler)
+	return
+}
+
+// AppendMethod appends a handler to the chain under a specified name like
+// Append but the handler is executed only for requests with the specified
+// HTTP method.
+//
+// If a chain contains handlers registered with AppendMethod and none of
+// them is registered for the request method, ServeHTTP responds with
+// 405 Method Not Allowed listing registered methods in the Allow header,
+// sets ErrMethodNotAllowed as the chain error and executes no handlers.
+func (c *Chain) AppendMethod(method, name string, handler http.Handler) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	if err := c.append(name, handler); err != nil {
+		return err
+	}
+	c.varmu.Lock()
+	c.methods[c.normalize(name)] = method
+	c.varmu.Unlock()
+	return nil
+}
+
+// AppendPrefix appends sub to the chain under prefix as name. Sub is
+// executed only for requests whose URL path starts with prefix and is
+// served a request with prefix stripped from the URL path, as by
+// http.StripPrefix. Errors in sub propagate to the chain like errors in
+// nested chains. If prefix is already a registered name ErrDupName sibling
+// is returned.
+func (c *Chain) AppendPrefix(prefix string, sub *Chain) error {
+	return c.Append(prefix, &prefixHandler{prefix, sub})
+}
+
+// AppendDynamic appends a handler to the chain under a specified name
+// like Append but the handler executed for a request is the one returned
+// by selector for that request. If selector returns nil the request
+// continues with the next handler.
+func (c *Chain) AppendDynamic(name string, selector func(*http.Request) http.Handler) error {
+	return c.Append(name, dynamicHandler(selector))
+}
+
+// dynamicHandler executes a handler selected per request.
+type dynamicHandler func(*http.Request) http.Handler
+
+// ServeHTTP implements http.Handler.
+func (dh dynamicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := dh(r); h != nil {
+		h.ServeHTTP(w, r)
+	}
+}
+
+// GroupWith appends a sub-chain to the chain under a specified name.
+// The sub-chain uses the chain key and contains middleware handlers,
+// registered under names "middleware 0", "middleware 1" and so on,
+// followed by handlers appended to it by build. Group handlers are thus
+// executed after the shared middleware. Errors in the sub-chain propagate
+// to the chain like errors in nested chains.
+// If name is already registered ErrDupName sibling is returned and build
+// is not called.
+func (c *Chain) GroupWith(name string, middleware []http.Handler, build func(sub *Chain)) error {
+	if _, exists := c.IndexOf(name); exists {
+		return c.strictErr(ErrDupName.WrapArgs(name))
+	}
+	sub := New(c.key)
+	for i, mw := range middleware {
+		sub.Append(fmt.Sprintf("middleware %d", i), mw)
+	}
+	if build != nil {
+		build(sub)
+	}
+	return c.Append(name, sub)
+}
+
+// prefixHandler executes a chain for requests with a path prefix.
+type prefixHandler struct {
+	prefix string
+	chain  *Chain
+}
+
+// ServeHTTP implements http.Handler.
+func (ph *prefixHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, ph.prefix)
+	if len(path) == len(r.URL.Path) {
+		return
+	}
+	rawpath := strings.TrimPrefix(r.URL.RawPath, ph.prefix)
+	if r.URL.RawPath != "" && len(rawpath) == len(r.URL.RawPath) {
+		return
+	}
+	sr := r.Clone(r.Context())
+	sr.URL.Path = path
+	sr.URL.RawPath = rawpath
+	ph.chain.ServeHTTP(w, sr)
+	if parent, exists := FromContext(r.Context()); exists {
+		parent.SetError(ph.chain.LastError())
+	}
+}
+
+// allowed returns true if link at index i should be executed for method.
+// runmu must be locked by the caller.
+func (c *Chain) allowed(i int, method string) bool {
+	if i >= len(c.indexes) {
+		return true
+	}
+	m, exists := c.methods[c.indexes[i]]
+	return !exists || m == method
+}
+
+// checkMethod responds with 405 Method Not Allowed and returns false if
+// the chain has method handlers but none for the method of r.
+// runmu must be locked by the caller.
+func (c *Chain) checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if len(c.methods) == 0 {
+		return true
+	}
+	allow := make([]string, 0, len(c.methods))
+	seen := make(map[string]bool)
+	for _, name := range c.indexes {
+		method, exists := c.methods[name]
+		if !exists || seen[method] {
+			continue
+		}
+		if method == r.Method {
+			return true
+		}
+		seen[method] = true
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	c.SetError(ErrMethodNotAllowed.WrapArgs(r.Method))
+	return false
+}
+
+// Pop removes the last handler from the chain and returns its name, the
+// handler and true or empty name, nil handler and false if the chain is
+// empty. Pop shares the lock with ServeHTTP.
+func (c *Chain) Pop() (name string, h http.Handler, ok bool) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	if len(c.indexes) == 0 {
+		return "", nil, false
+	}
+	name, h = c.removeAt(len(c.indexes) - 1)
+	return name, h, true
+}
+
+// Shift removes the first handler from the chain and returns its name, the
+// handler and true or empty name, nil handler and false if the chain is
+// empty. Positions of remaining handlers are decremented by one.
+// Shift shares the lock with ServeHTTP.
+func (c *Chain) Shift() (name string, h http.Handler, ok bool) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	if len(c.indexes) == 0 {
+		return "", nil, false
+	}
+	name, h = c.removeAt(0)
+	return name, h, true
+}
+
+// Reorder rearranges handlers in the order of names which must contain
+// exactly the names of all registered handlers.
+// If the number of names differs from the number of handlers ErrNameCount
+// sibling is returned, if a name is not registered ErrInvalidName sibling
+// is returned and if a name is specified more than once ErrDupName sibling
+// is returned. The chain is not modified if an error occurs.
+// Reorder shares the lock with ServeHTTP.
+func (c *Chain) Reorder(names []string) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	if len(names) != len(c.indexes) {
+		return ErrNameCount.WrapArgs(len(c.indexes), len(names))
+	}
+	keys := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		key := c.normalize(name)
+		if _, exists := c.names[key]; !exists {
+			return ErrInvalidName.WrapArgs(name)
+		}
+		if seen[key] {
+			return ErrDupName.WrapArgs(name)
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	c.reorder(keys)
+	return nil
+}
+
+// SortBy rearranges handlers by sorting their names as registered using
+// less. The sort is stable, handlers whose names compare equal keep their
+// relative order. SortBy shares the lock with ServeHTTP.
+func (c *Chain) SortBy(less func(a, b string) bool) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	keys := append([]string(nil), c.indexes...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return less(c.spells[keys[i]], c.spells[keys[j]])
+	})
+	c.reorder(keys)
+}
+
+// reorder rearranges handlers in the order of names which must be a
+// permutation of registered names. runmu must be locked by the caller.
+func (c *Chain) reorder(names []string) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	links := make([]http.Handler, 0, len(names))
+	for _, name := range names {
+		links = append(links, c.links[c.names[name]])
+	}
+	c.links = links
+	c.indexes = append([]string(nil), names...)
+	for i, name := range c.indexes {
+		c.names[name] = i
+	}
+}
+
+// InjectBefore wraps the handler registered under anchorName with mw and
+// registers the resulting handler under newName in place of the anchor.
+// The anchor is removed from the chain while its position, method
+// restriction, terminal mark, entry points and jumps declared from it are
+// taken over by newName.
+// If anchorName is not registered ErrInvalidName sibling is returned and
+// if newName is already registered ErrDupName sibling is returned.
+// InjectBefore shares the lock with ServeHTTP.
+func (c *Chain) InjectBefore(anchorName, newName string, mw func(http.Handler) http.Handler) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	anchor := c.normalize(anchorName)
+	i, exists := c.names[anchor]
+	if !exists {
+		return ErrInvalidName.WrapArgs(anchorName)
+	}
+	key := c.normalize(newName)
+	if key != anchor {
+		if _, err := c.checkName(newName); err != nil {
+			return err
+		}
+	}
+	h := mw(c.links[i])
+
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.links[i] = h
+	c.indexes[i] = key
+	delete(c.names, anchor)
+	delete(c.spells, anchor)
+	c.names[key] = i
+	c.spells[key] = newName
+	if method, exists := c.methods[anchor]; exists {
+		delete(c.methods, anchor)
+		c.methods[key] = method
+	}
+	if terminal, exists := c.marks[anchor]; exists {
+		delete(c.marks, anchor)
+		c.marks[key] = terminal
+	}
+	for path, name := range c.entries {
+		if name == anchor {
+			c.entries[path] = key
+		}
+	}
+	delete(c.overrides, anchor)
+	if c.disabled[anchor] {
+		delete(c.disabled, anchor)
+		c.disabled[key] = true
+	}
+	if c.barriers[anchor] {
+		delete(c.barriers, anchor)
+		c.barriers[key] = true
+	}
+	if targets, exists := c.jumpdecl[anchor]; exists {
+		delete(c.jumpdecl, anchor)
+		c.jumpdecl[key] = targets
+	}
+	if key != anchor {
+		c.dropStats(anchor)
+	}
+	if _, exists := c.stats[key]; !exists {
+		c.stats[key] = &handlerStats{}
+	}
 	return nil
 }
 
+// Splice inserts handlers of other into the chain at index at, which
+// must be in range [0, len] or ErrInvalidIndex sibling is returned.
+// Handlers are inserted individually under their names in other together
+// with their method restrictions, terminal marks, barriers and disabled
+// states, producing a flat chain rather than nesting other. If any of the
+// names is already registered ErrDupName sibling is returned and the chain
+// is not modified. Splice shares the lock with ServeHTTP.
+func (c *Chain) Splice(at int, other *Chain) error {
+	other.runmu.Lock()
+	n := len(other.indexes)
+	links := make([]http.Handler, n)
+	copy(links, other.links)
+	spells := make([]string, n)
+	methods := make(map[string]string)
+	marks := make(map[string]bool)
+	disabled := make(map[string]bool)
+	barriers := make(map[string]bool)
+	other.varmu.Lock()
+	for i, key := range other.indexes {
+		name := other.spells[key]
+		spells[i] = name
+		if method, exists := other.methods[key]; exists {
+			methods[name] = method
+		}
+		if terminal, exists := other.marks[key]; exists {
+			marks[name] = terminal
+		}
+		disabled[name] = other.disabled[key]
+		barriers[name] = other.barriers[key]
+	}
+	other.varmu.Unlock()
+	other.runmu.Unlock()
+
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	if at < 0 || at > len(c.links) {
+		return ErrInvalidIndex.WrapArgs(at)
+	}
+	keys := make([]string, n)
+	for i, name := range spells {
+		key, err := c.checkName(name)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.links = append(c.links[:at], append(links, c.links[at:]...)...)
+	c.indexes = append(c.indexes[:at], append(keys, c.indexes[at:]...)...)
+	for i, key := range keys {
+		name := spells[i]
+		c.spells[key] = name
+		if method, exists := methods[name]; exists {
+			c.methods[key] = method
+		}
+		if terminal, exists := marks[name]; exists {
+			c.marks[key] = terminal
+		}
+		if disabled[name] {
+			c.disabled[key] = true
+		}
+		if barriers[name] {
+			c.barriers[key] = true
+		}
+		if _, exists := c.stats[key]; !exists {
+			c.stats[key] = &handlerStats{}
+		}
+	}
+	for i := at; i < len(c.indexes); i++ {
+		c.names[c.indexes[i]] = i
+	}
+	return nil
+}
+
+// removeAt removes the handler at index i and returns its name and the
+// handler. runmu must be locked by the caller.
+func (c *Chain) removeAt(i int) (name string, h http.Handler) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	name, h = c.indexes[i], c.links[i]
+	c.links = append(c.links[:i], c.links[i+1:]...)
+	c.indexes = append(c.indexes[:i], c.indexes[i+1:]...)
+	delete(c.names, name)
+	delete(c.spells, name)
+	for j := i; j < len(c.indexes); j++ {
+		c.names[c.indexes[j]] = j
+	}
+	delete(c.marks, name)
+	delete(c.methods, name)
+	delete(c.overrides, name)
+	delete(c.disabled, name)
+	delete(c.barriers, name)
+	c.dropStats(name)
+	return
+}
+
 // Names returns the names of handlers as registered in order
 // as they were registered or an empty slice if none registered.
 // Names() shares the lock with ServeHTTP.
@@ -74,32 +783,363 @@ func (c *Chain) Names() []string {
 	for _, name := range c.indexes {
 		r = append(r, name)
 	}
-	return r
-}
-
-// Clone clones this chain.
-// Possibly to have instances for multiple threads.
-func (c *Chain) Clone() *Chain {
-	c.runmu.Lock()
-	defer c.runmu.Unlock()
+	return r
+}
+
+// Close deregisters the chain from all Registries it was registered with,
+// releases its expvars published by PublishExpvar and stops the error sink
+// set by SetErrorSink.
+// The chain remains usable after Close.
+func (c *Chain) Close() error {
+	c.varmu.Lock()
+	registries := c.registries
+	c.registries = make(map[*Registry]string)
+	c.varmu.Unlock()
+
+	for registry, name := range registries {
+		registry.deregister(name, c)
+	}
+	c.UnpublishExpvar()
+	c.SetErrorSink(nil, 0)
+	return nil
+}
+
+// SetEntryPoint makes ServeHTTP start executing the chain from a handler
+// registered under handlerName for requests whose URL path equals path.
+// Requests with paths without an entry point start from the first handler.
+// If handlerName is not registered ErrInvalidName sibling is returned.
+func (c *Chain) SetEntryPoint(path, handlerName string) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	key := c.normalize(handlerName)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(handlerName)
+	}
+	c.entries[path] = key
+	return nil
+}
+
+// entryPoint returns the index of the handler to start serving r from.
+// runmu must be locked by the caller.
+func (c *Chain) entryPoint(r *http.Request) int {
+	if name, exists := c.entries[r.URL.Path]; exists {
+		if index, exists := c.names[name]; exists {
+			return index
+		}
+	}
+	return 0
+}
+
+// IndexOf returns the zero-based position of a handler registered under
+// name and true or 0 and false if no such handler is registered.
+func (c *Chain) IndexOf(name string) (int, bool) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	index, exists := c.names[c.normalize(name)]
+	return index, exists
+}
+
+// Contains returns true if handler instance h is registered in the chain.
+// Pointer handlers are compared by address and other comparable handlers
+// by value. Handlers that are not comparable, such as http.HandlerFunc,
+// are never reported as contained.
+func (c *Chain) Contains(h http.Handler) bool {
+	id, ok := handlerIdentity(h)
+	if !ok {
+		return false
+	}
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	for _, link := range c.links {
+		if linkid, ok := handlerIdentity(link); ok && linkid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns names of handlers matching pattern, as defined by
+// path.Match, in order as they are registered, or nil if none match or
+// pattern is malformed. Pattern is normalized like a handler name.
+func (c *Chain) Find(pattern string) (names []string) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	pattern = c.normalize(pattern)
+	for _, name := range c.indexes {
+		if matched, err := path.Match(pattern, name); err != nil {
+			return nil
+		} else if matched {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// GetAt returns the name and handler at zero-based position index and
+// true or empty name, nil handler and false if index is out of range.
+func (c *Chain) GetAt(index int) (string, http.Handler, bool) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if index < 0 || index >= len(c.indexes) {
+		return "", nil, false
+	}
+	return c.indexes[index], c.links[index], true
+}
+
+// Clone clones this chain.
+// Possibly to have instances for multiple threads.
+func (c *Chain) Clone() *Chain {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	clone, _ := c.clone(nil, true)
+	return clone
+}
+
+// Map returns a new chain with the same key, configuration and callbacks
+// as this chain but with no variables, in which each handler is replaced
+// by the result of fn called with its name and the handler. If fn returns
+// an empty name the original name is kept. Handler settings such as
+// method restrictions, entry points and barriers follow renamed handlers.
+// Map panics with ErrDupName sibling if fn returns duplicate names.
+func (c *Chain) Map(fn func(name string, h http.Handler) (string, http.Handler)) *Chain {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	mapped, err := c.clone(fn, false)
+	if err != nil {
+		panic(err)
+	}
+	return mapped
+}
+
+// clone returns a copy of the chain with handlers transformed by fn, if
+// not nil, and with variables if vars is true.
+// runmu must be locked by the caller.
+func (c *Chain) clone(fn func(name string, h http.Handler) (string, http.Handler), vars bool) (*Chain, error) {
+	clone := New(c.key)
+	clone.drainbody = c.drainbody
+	clone.teesel = c.teesel
+	clone.teesink = c.teesink
+	clone.tracelimit = c.tracelimit
+	clone.diaglog = c.diaglog
+	clone.bodymax = c.bodymax
+	clone.sampler = c.sampler
+	clone.maxvars = c.maxvars
+	clone.maxdepth = c.maxdepth
+	clone.strictbar = c.strictbar
+	clone.strictjumps = c.strictjumps
+	clone.strict = c.strict
+	clone.recoverfn = c.recoverfn
+	clone.clock = c.clock
+	clone.observer = c.observer
+	clone.counting = c.counting
+	clone.hdrdeadline = c.hdrdeadline
+	clone.latewrite = c.latewrite
+	clone.cancelerr = c.cancelerr
+	clone.runlogger = c.runlogger
+	clone.enrichlog = c.enrichlog
+	clone.streamtrailer = c.streamtrailer
+	clone.streamhook = c.streamhook
+	clone.namenorm = c.namenorm
+	clone.redactor = c.redactor
+	renamed := make(map[string]string, len(c.links))
+	for i, link := range c.links {
+		name := c.spells[c.indexes[i]]
+		if fn != nil {
+			newname, h := fn(name, link)
+			if newname != "" {
+				name = newname
+			}
+			link = h
+		}
+		if err := clone.append(name, link); err != nil {
+			return nil, err
+		}
+		renamed[c.indexes[i]] = clone.indexes[i]
+	}
+	for path, name := range c.entries {
+		clone.entries[path] = renamed[name]
+	}
+	for name, terminal := range c.marks {
+		clone.marks[renamed[name]] = terminal
+	}
+	for name, method := range c.methods {
+		clone.methods[renamed[name]] = method
+	}
+	clone.onsuccess = append(clone.onsuccess, c.onsuccess...)
+	clone.onfailure = append(clone.onfailure, c.onfailure...)
+	clone.deferred = append(clone.deferred, c.deferred...)
+	clone.errorfunc = c.errorfunc
+	clone.emptyfunc = c.emptyfunc
+	clone.wrapfunc = c.wrapfunc
+	clone.metrics = c.metrics
+	clone.errxform = c.errxform
+	clone.onfirst = c.onfirst
+	clone.onpanic = c.onpanic
+	clone.ongone = c.ongone
+	clone.errmap = append(clone.errmap, c.errmap...)
+	c.varmu.Lock()
+	if vars {
+		for k, v := range c.vars {
+			clone.vars[k] = v
+		}
+	}
+	for k, v := range c.provided {
+		clone.provided[k] = v
+	}
+	clone.watchers = append(clone.watchers, c.watchers...)
+	for name := range c.disabled {
+		clone.disabled[renamed[name]] = true
+	}
+	for name := range c.barriers {
+		clone.barriers[renamed[name]] = true
+	}
+	for from, targets := range c.jumpdecl {
+		if clone.jumpdecl == nil {
+			clone.jumpdecl = make(map[string]map[string]bool)
+		}
+		if renamed[from] != "" {
+			from = renamed[from]
+		}
+		clone.jumpdecl[from] = make(map[string]bool, len(targets))
+		for target := range targets {
+			if renamed[target] != "" {
+				target = renamed[target]
+			}
+			clone.jumpdecl[from][target] = true
+		}
+	}
+	c.varmu.Unlock()
+	return clone, nil
+}
+
+// CloneWithKey clones this chain like Clone but under a different key.
+// Nested chains that share this chain's key are cloned with key as well.
+func (c *Chain) CloneWithKey(key interface{}) *Chain {
+	clone := c.Clone()
+	clone.key = key
+	for i, link := range clone.links {
+		if nested, ok := link.(*Chain); ok && nested.key == c.key {
+			clone.links[i] = nested.CloneWithKey(key)
+		}
+	}
+	return clone
+}
+
+// Reset clears all state derived from chain execution such as the last
+// error, pending MoveTo, trace and WasExecuted while keeping registered handlers,
+// callbacks, overrides and variables. It performs the same setup that
+// ServeHTTP performs before executing handlers.
+// Reset shares the lock with ServeHTTP.
+func (c *Chain) Reset() {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.reset()
+	c.varmu.Lock()
+	c.ran = false
+	c.varmu.Unlock()
+}
+
+// reset clears execution state.
+func (c *Chain) reset() {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.err = nil
+	c.next = ""
+	c.trace = c.trace[:0]
+	c.jumps = nil
+	c.status = 0
+	c.dropped = 0
+	c.afterrun = nil
+	c.wrappers = nil
+	c.unwrap = nil
+	c.executed = 0
+	c.handled = false
+	c.snapshots = nil
+	c.failed = false
+	c.current = ""
+	c.passed = nil
+	c.errpath = ""
+}
+
+// SetError records an error and stops chain execution
+// once surrently executed handler finishes.
+// If an error transformer is set, a non-nil err is replaced by its result.
+func (c *Chain) SetError(err error) {
+	if err != nil {
+		c.varmu.Lock()
+		xform := c.errxform
+		c.varmu.Unlock()
+		if xform != nil {
+			err = xform(err)
+		}
+	}
+
+	c.varmu.Lock()
+	c.err = err
+	if err != nil {
+		c.errpath = c.current
+	}
+	first := err != nil && !c.failed
+	if first {
+		c.failed = true
+	}
+	onfirst, current := c.onfirst, c.current
+	onerrwr, minbytes, written := c.onerrwr, c.errwrmin, int64(0)
+	if onerrwr != nil && err != nil && c.rec != nil {
+		written = c.rec.bytes() - c.linkbytes
+	}
+	c.varmu.Unlock()
 
-	clone := New(c.key)
-	for _, link := range c.links {
-		clone.links = append(clone.links, link)
+	if first && onfirst != nil {
+		onfirst(err, current)
 	}
-	for k, v := range c.vars {
-		clone.vars[k] = v
+	if onerrwr != nil && err != nil && current != "" && written >= minbytes && written > 0 {
+		onerrwr(current, written, err)
 	}
-	return clone
 }
 
-// SetError records an error and stops chain execution
-// once surrently executed handler finishes.
-func (c *Chain) SetError(err error) {
+// SetOnFirstError sets a function called with the error and the name of
+// the handler being executed when a non-nil error is set for the first
+// time during a ServeHTTP call. Subsequent errors set during the same
+// call do not trigger fn. A nil fn removes the function.
+func (c *Chain) SetOnFirstError(fn func(err error, name string)) {
 	c.varmu.Lock()
 	defer c.varmu.Unlock()
 
-	c.err = err
+	c.onfirst = fn
+}
+
+// SetOnErrorAfterWrite sets a function called with the name of the
+// handler being executed, the number of response bytes it wrote and the
+// error when the handler sets a non-nil error after writing at least
+// minBytes of the response body, which usually indicates inconsistent
+// error handling as the error can no longer be reflected in the response.
+// A nil fn removes the function.
+func (c *Chain) SetOnErrorAfterWrite(minBytes int64, fn func(name string, written int64, err error)) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.onerrwr = fn
+	c.errwrmin = minBytes
+}
+
+// SetErrorTransformer sets a function that transforms every non-nil error
+// passed to SetError before it is recorded, for instance to hide internal
+// error details. A nil fn removes the transformer.
+func (c *Chain) SetErrorTransformer(fn func(error) error) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.errxform = fn
 }
 
 // LastError returns last recorded error, if any.
@@ -122,17 +1162,108 @@ func (c *Chain) LastError() error {
 func (c *Chain) MoveTo(name string) error {
 	c.varmu.Lock()
 	defer c.varmu.Unlock()
-	if _, exists := c.names[name]; !exists {
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return c.strictErr(ErrInvalidName.WrapArgs(name))
+	}
+	if err := c.checkJump(key); err != nil {
+		return c.strictErr(err)
+	}
+	if barrier := c.barrierBefore(key); barrier != "" {
+		if c.strictbar {
+			return c.strictErr(ErrBarrierViolation.WrapArgs(name, barrier))
+		}
+		key = barrier
+	}
+	c.next = key
+	return nil
+}
+
+// Override substitutes the handler registered under name with h for a
+// single request only; the chain itself is left unchanged.
+// If called from a handler executing in a chain the override applies to
+// the remainder of the current request, otherwise it applies to the next
+// request served by the chain. Overrides are cleared when ServeHTTP returns.
+//
+// If name is not registered ErrInvalidName sibling is returned.
+func (c *Chain) Override(name string, h http.Handler) error {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(name)
+	}
+	c.overrides[key] = h
+	return nil
+}
+
+// Disable makes the chain skip the handler registered under name until
+// it is enabled with Enable. If name is not registered ErrInvalidName
+// sibling is returned. Disable can be called from a handler executing in
+// the chain or concurrently with ServeHTTP.
+func (c *Chain) Disable(name string) error {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(name)
+	}
+	c.disabled[key] = true
+	atomic.StoreInt32(&c.disabling, 1)
+	return nil
+}
+
+// Enable enables a handler registered under name disabled by Disable.
+// If name is not registered ErrInvalidName sibling is returned.
+func (c *Chain) Enable(name string) error {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
 		return ErrInvalidName.WrapArgs(name)
 	}
-	c.next = name
+	delete(c.disabled, key)
 	return nil
 }
 
+// IsDisabled returns true if the handler registered under name is
+// disabled.
+func (c *Chain) IsDisabled(name string) bool {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return c.disabled[c.normalize(name)]
+}
+
+// isDisabled returns true if the link at index i is disabled.
+func (c *Chain) isDisabled(i int) bool {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return c.disabled[c.indexes[i]]
+}
+
+// link returns the handler at index i, respecting overrides.
+func (c *Chain) link(i int) http.Handler {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if h, ok := c.overrides[c.indexes[i]]; ok {
+		return h
+	}
+	return c.links[i]
+}
+
 // Get gets a context variable by key and returns it as interface and
 // a truth if it exists.
 func (c *Chain) Get(key string) (val interface{}, ok bool) {
 	c.varmu.Lock()
+	if scope := c.scope; scope != nil {
+		c.varmu.Unlock()
+		return scope.Get(key)
+	}
 	defer c.varmu.Unlock()
 
 	val, ok = c.vars[key]
@@ -140,41 +1271,623 @@ func (c *Chain) Get(key string) (val interface{}, ok bool) {
 }
 
 // Set sets a context variable by key to val.
-func (c *Chain) Set(key string, val interface{}) {
+// If setting a new variable would exceed the maximum number of variables
+// set by WithMaxVarSize, ErrTooManyVars sibling is returned.
+func (c *Chain) Set(key string, val interface{}) (err error) {
+	c.varmu.Lock()
+	scope, watchers := c.scope, c.watchers
+	c.varmu.Unlock()
+
+	if scope != nil {
+		err = scope.Set(key, val)
+	} else {
+		err = c.set(key, val)
+	}
+	if err == nil {
+		notifyVars(watchers, VarOpSet, key, val)
+	}
+	return
+}
+
+// With sets a context variable by key to val like Set and returns the
+// chain, allowing variables to be set inline during chain construction.
+// An error returned by Set, possible only if WithMaxVarSize was specified,
+// is ignored.
+func (c *Chain) With(key string, val interface{}) *Chain {
+	c.Set(key, val)
+	return c
+}
+
+// set sets a chain variable by key to val.
+func (c *Chain) set(key string, val interface{}) error {
 	c.varmu.Lock()
 	defer c.varmu.Unlock()
 
+	if _, exists := c.vars[key]; !exists && c.maxvars > 0 && len(c.vars) >= c.maxvars {
+		return ErrTooManyVars.WrapArgs(c.maxvars)
+	}
 	c.vars[key] = val
+	return nil
+}
+
+// Delete deletes a context variable by key from the chain's own variables
+// and returns its value and a truth if it existed. Like ExportVars it
+// does not operate on a VarScope passed to ServeWithScope.
+func (c *Chain) Delete(key string) (val interface{}, ok bool) {
+	c.varmu.Lock()
+	watchers := c.watchers
+	if val, ok = c.vars[key]; ok {
+		delete(c.vars, key)
+	}
+	c.varmu.Unlock()
+
+	if ok {
+		notifyVars(watchers, VarOpDelete, key, val)
+	}
+	return
+}
+
+const (
+	// VarOpSet is the operation passed to variable watchers by Set and
+	// ImportVars.
+	VarOpSet = "set"
+	// VarOpDelete is the operation passed to variable watchers by Delete.
+	VarOpDelete = "delete"
+)
+
+// WatchVars registers fn to be called after each change of a context
+// variable with the operation, VarOpSet or VarOpDelete, the key and the
+// value that was set or deleted. Watchers are called in order as they
+// were registered from the goroutine changing the variable. It is meant
+// as a debugging aid.
+func (c *Chain) WatchVars(fn func(op string, key string, val interface{})) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.watchers = append(c.watchers, fn)
+}
+
+// notifyVars calls watchers with op, key and val.
+func notifyVars(watchers []func(string, string, interface{}), op, key string, val interface{}) {
+	for _, fn := range watchers {
+		fn(op, key, val)
+	}
+}
+
+// VarCount returns the number of context variables currently set.
+func (c *Chain) VarCount() int {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return len(c.vars)
+}
+
+// ExportVars returns a copy of all context variables.
+//
+// Strings, booleans, numbers, byte and string slices as well as maps and
+// slices of interface{} containing such values are deep-copied.
+// All other values, such as pointers, structs holding references or
+// channels are copied by reference and remain shared with the chain.
+func (c *Chain) ExportVars() map[string]interface{} {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return copyVars(c.vars)
+}
+
+// ImportVars sets context variables from m, overwriting existing variables
+// with the same keys. Values are copied as described by ExportVars.
+// If importing would exceed the maximum number of variables set by
+// WithMaxVarSize, nothing is imported and ErrTooManyVars sibling is
+// returned.
+func (c *Chain) ImportVars(m map[string]interface{}) error {
+	c.varmu.Lock()
+	if c.maxvars > 0 {
+		count := len(c.vars)
+		for k := range m {
+			if _, exists := c.vars[k]; !exists {
+				count++
+			}
+		}
+		if count > c.maxvars {
+			c.varmu.Unlock()
+			return ErrTooManyVars.WrapArgs(c.maxvars)
+		}
+	}
+	for k, v := range m {
+		c.vars[k] = copyVar(v)
+	}
+	watchers := c.watchers
+	c.varmu.Unlock()
+
+	for k, v := range m {
+		notifyVars(watchers, VarOpSet, k, v)
+	}
+	return nil
+}
+
+// InitVars sets context variables of the chain to copies of values in
+// vars, overwriting existing variables with the same keys, without
+// enforcing WithMaxVarSize or notifying variable watchers. It is meant for
+// configuration values such as connections or feature flags and should
+// be called only before the chain serves its first request; if it is
+// called later a warning is logged to the logger set by WithLogger and
+// variables are set nevertheless.
+func (c *Chain) InitVars(vars map[string]interface{}) {
+	if atomic.LoadUint64(&c.requests) > 0 || atomic.LoadInt32(&c.inflight) > 0 {
+		c.diagf("InitVars called after the chain started serving")
+	}
+	c.initVars(vars)
+}
+
+// initVars copies vars into chain variables.
+func (c *Chain) initVars(vars map[string]interface{}) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	for k, v := range vars {
+		c.vars[k] = copyVar(v)
+	}
+}
+
+// copyVars returns a copy of vars using copyVar.
+func copyVars(vars map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		r[k] = copyVar(v)
+	}
+	return r
+}
+
+// copyVar returns a deep copy of v if v is a simple value or a container
+// of simple values, otherwise v.
+func copyVar(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return append([]byte(nil), t...)
+	case []string:
+		return append([]string(nil), t...)
+	case []interface{}:
+		r := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			r = append(r, copyVar(e))
+		}
+		return r
+	case map[string]string:
+		r := make(map[string]string, len(t))
+		for k, e := range t {
+			r[k] = e
+		}
+		return r
+	case map[string]interface{}:
+		return copyVars(t)
+	}
+	return v
+}
+
+// WasExecuted returns true if ServeHTTP was called at least once since
+// the chain was created or last Reset.
+func (c *Chain) WasExecuted() bool {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return c.ran
+}
+
+// IsRunning returns true if ServeHTTP is currently executing, i.e. while
+// it holds the lock shared with methods that modify the chain.
+func (c *Chain) IsRunning() bool {
+	return atomic.LoadInt32(&c.running) > 0
+}
+
+// wrapWriter makes handlers that follow the currently executing handler
+// in the current run write to a writer returned by wrap. Once the handler
+// loop ends, done is called so the wrapper can complete the response.
+// Wrappers are completed in reverse order of wrapping before post-run
+// handlers are executed with the unwrapped writer.
+func (c *Chain) wrapWriter(wrap func(http.ResponseWriter) http.ResponseWriter, done func()) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.wrappers = append(c.wrappers, wrap)
+	c.unwrap = append(c.unwrap, done)
+}
+
+// applyWrappers returns w wrapped with pending wrappers.
+func (c *Chain) applyWrappers(w http.ResponseWriter) http.ResponseWriter {
+	c.varmu.Lock()
+	wrappers := c.wrappers
+	c.wrappers = nil
+	c.varmu.Unlock()
+
+	for _, wrap := range wrappers {
+		w = wrap(w)
+	}
+	return w
+}
+
+// unwrapAll completes all wrappers of the current run.
+func (c *Chain) unwrapAll() {
+	c.varmu.Lock()
+	unwrap := c.unwrap
+	c.unwrap = nil
+	c.varmu.Unlock()
+
+	for i := len(unwrap) - 1; i >= 0; i-- {
+		if unwrap[i] != nil {
+			unwrap[i]()
+		}
+	}
+}
+
+// setScope sets the variable scope of the current run.
+func (c *Chain) setScope(scope VarScope) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.scope = scope
+}
+
+// Provide sets a value under key which ServeHTTP puts into the context of
+// every request it serves. Provided values are copied by Clone.
+// Key must be comparable and should not collide with the chain key.
+func (c *Chain) Provide(key, val interface{}) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.provided[key] = val
+}
+
+// VarScope is a storage of context variables.
+type VarScope interface {
+	// Get returns a variable by key and a truth if it exists.
+	Get(key string) (val interface{}, ok bool)
+	// Set sets a variable by key to val.
+	Set(key string, val interface{}) error
+}
+
+// ServeWithScope serves the request like ServeHTTP but Get and Set of the
+// chain read and write variables through scope instead of the chain's own
+// variables for the duration of the request. Other variable methods such
+// as ExportVars and VarCount still operate on the chain's own variables.
+func (c *Chain) ServeWithScope(scope VarScope, w http.ResponseWriter, r *http.Request) {
+	c.serve(scope, time.Time{}, w, r)
 }
 
 // ServeHTTP passes w and r across the handler chain.
 // If a handler sets Chain error during execution, loop is aborted.
+// If a write to w fails with http.ErrHandlerTimeout, for instance because
+// the chain is wrapped in http.TimeoutHandler, the loop is aborted with
+// ErrHandlerTimeout once the writing handler returns.
 // Chained handlers are checked if they are Chains themselves. If an error
 // occurs in such chain, the error is propagated to the top chain.
+// After the loop the result is dispatched to post-run handlers as
+// described by DeferHandler.
 func (c *Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.serve(nil, time.Time{}, w, r)
+}
+
+// ServeHTTPAndCapture serves r into an internal response recorder and
+// returns the recorded status code, body and the chain error of the run.
+// If w is not nil the recorded header, status code and body are copied to
+// w after the run. It is intended for use in tests.
+func (c *Chain) ServeHTTPAndCapture(w http.ResponseWriter, r *http.Request) (statusCode int, body []byte, err error) {
+	rec := newBufferWriter()
+	err = c.serve(nil, time.Time{}, rec, r).err
+	if w != nil {
+		copyResponse(w, rec)
+	}
+	return rec.code(), rec.body.Bytes(), err
+}
+
+// runOutcome is the outcome of a run captured before the run releases
+// the chain to other requests.
+type runOutcome struct {
+	// err is the chain error of the run.
+	err error
+	// handled is true if the error handler was called during the run.
+	handled bool
+	// errorfunc is the error handler of the chain during the run.
+	errorfunc func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// serve serves the request using scope for variables if not nil and
+// stops once deadline passes if it is not zero. It returns the outcome of
+// the run which, unlike LastError, cannot be overwritten by a concurrent
+// request before the caller inspects it.
+func (c *Chain) serve(scope VarScope, deadline time.Time, w http.ResponseWriter, r *http.Request) (out runOutcome) {
+
+	// The run that is serving r holds runmu.
+	if err := c.recursion(r.Context()); err != nil {
+		c.diagf("%s %s: maximum nesting depth exceeded", r.Method, r.URL.Path)
+		c.SetError(err)
+		return runOutcome{err: err}
+	}
+
+	atomic.AddInt32(&c.inflight, 1)
+	defer atomic.AddInt32(&c.inflight, -1)
+
+	c.enter()
+	defer c.leave()
 
 	c.runmu.Lock()
 	defer c.runmu.Unlock()
 
-	c.SetError(nil)
-	r = r.Clone(context.WithValue(r.Context(), c.key, c))
-	for i := 0; i < len(c.links) && c.LastError() == nil; i++ {
+	atomic.AddInt32(&c.running, 1)
+	defer atomic.AddInt32(&c.running, -1)
+
+	c.setScope(scope)
+	defer c.setScope(nil)
+
+	defer func() {
+		c.varmu.Lock()
+		out = runOutcome{c.err, c.handled, c.errorfunc}
+		c.overrides = make(map[string]http.Handler)
+		c.rec = nil
+		c.finishTrace()
+		c.reportError(r)
+		if c.err != nil {
+			atomic.AddUint64(&c.failures, 1)
+		}
+		c.varmu.Unlock()
+		atomic.AddUint64(&c.requests, 1)
+	}()
+
+	if c.teesel != nil && c.teesel(r) {
+		tw := c.newTeeWriter(w, c.teesink(r))
+		defer tw.close()
+		w = tw
+	}
+	rec := newRecorder(w)
+	if c.latewrite != LateWriteAllow {
+		defer rec.close(c.lateWrite)
+	}
+	w = rec
+
+	c.reset()
+	sampled := c.sampler == nil || c.sampler(r)
+	c.varmu.Lock()
+	c.ran = true
+	c.rec = rec
+	c.sampled = sampled
+	c.varmu.Unlock()
+	var visited []string
+	if _, nop := c.observer.(NopObserver); sampled && !nop && c.observer != nil {
+		defer func() { c.observer.Complete(visited, c.LastError()) }()
+	}
+	if c.metrics != nil {
+		c.metrics.IncRequest()
+	}
+	clientctx := r.Context()
+	ctx := c.runContext(r)
+	c.cancelrun = nil
+	if c.cancelerr {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		c.cancelrun = cancel
+	}
+	ctx, err := c.withDepth(ctx)
+	r = r.Clone(context.WithValue(ctx, c.key, c))
+	if err != nil {
+		c.diagf("%s %s: maximum nesting depth exceeded", r.Method, r.URL.Path)
+		c.SetError(err)
+		c.finish(w, r)
+		return
+	}
+	if !c.checkMethod(w, r) {
+		c.finish(w, r)
+		return
+	}
+	if r, err = c.bufferBody(r); err != nil {
+		c.SetError(err)
+		c.finish(w, r)
+		return
+	}
+	lw := w
+	var dw *deadlineWriter
+	if c.hdrdeadline > 0 {
+		dw = c.newDeadlineWriter(rec, r)
+		defer dw.stop()
+		lw = dw
+	}
+	if c.wrapfunc != nil {
+		lw = c.wrapfunc(lw)
+	}
+	wrapped := lw
+	fs := c.features(sampled, deadline)
+	if fs.has(featClientGone) {
+		defer c.watchClient(clientctx, r)()
+	}
+	c.varmu.Lock()
+	linkhooks := c.linkhooks
+	c.varmu.Unlock()
+	for i := c.entryPoint(r); i < len(c.links) && c.LastError() == nil; i++ {
+		if fs.has(featClientGone) && c.clientGone() {
+			c.SetError(ErrClientGone)
+			break
+		}
+		if fs.has(featMethods) && !c.allowed(i, r.Method) {
+			continue
+		}
+		if fs.has(featDeadline) && !c.now().Before(deadline) {
+			c.SetError(ErrDeadlineExceeded)
+			break
+		}
+		if (fs.has(featDisabled) || atomic.LoadInt32(&c.disabling) != 0) && c.isDisabled(i) {
+			for _, hook := range linkhooks {
+				(*hook)(c.indexes[i], nil, true)
+			}
+			continue
+		}
 		// Execute link supporting nested Chains.
-		chain, ok := c.links[i].(*Chain)
-		if ok {
-			chain.ServeHTTP(w, r)
-			c.SetError(chain.LastError())
-		} else {
-			c.links[i].ServeHTTP(w, r)
+		c.executed++
+		if fs.has(featDiag) && c.executed == DiagLoopFactor*len(c.links)+1 {
+			c.diagf("%s %s: %d handler executions in a chain of %d handlers, possible MoveTo loop",
+				r.Method, r.URL.Path, c.executed, len(c.links))
+		}
+		if fs.has(featCounters) {
+			c.count(i)
+		}
+		if fs.has(featTrace) {
+			c.traceLink(i)
+		}
+		c.varmu.Lock()
+		c.current = c.indexes[i]
+		c.linkbytes = rec.bytes()
+		if c.barriers[c.current] {
+			if c.passed == nil {
+				c.passed = make(map[string]bool)
+			}
+			c.passed[c.current] = true
+		}
+		c.varmu.Unlock()
+		link := c.link(i)
+		var start, diagstart time.Time
+		if fs.has(featObserver) {
+			visited = append(visited, c.indexes[i])
+			c.observer.Start(c.indexes[i], r)
+		}
+		if fs.has(featStats) {
+			start = time.Now()
+		}
+		if fs.has(featDiag) {
+			diagstart = c.now()
+		}
+		c.invoke(i, link, lw, r)
+		if rec.timedOut() && c.LastError() == nil {
+			c.SetError(ErrHandlerTimeout)
+		}
+		if fs.has(featDiag) {
+			if dur := c.now().Sub(diagstart); dur > DiagSlowHandler {
+				c.diagf("%s %s: handler '%s' executed in %v", r.Method, r.URL.Path, c.indexes[i], dur)
+			}
+		}
+		if fs.has(featStats) {
+			dur := time.Since(start)
+			c.recordStats(i, dur)
+			if fs.has(featObserver) {
+				c.observer.End(c.indexes[i], dur, c.LastError())
+			}
+			if fs.has(featMetrics) {
+				c.metrics.ObserveDuration(c.indexes[i], dur)
+			}
+		}
+		if fs.has(featHooks) {
+			for _, hook := range linkhooks {
+				(*hook)(c.indexes[i], c.LastError(), false)
+			}
+		}
+		if fs.has(featMetrics) && c.LastError() != nil {
+			c.metrics.IncError(c.indexes[i])
+		}
+		lw = c.applyWrappers(lw)
+		// Process RequestAnnotator.
+		if annotator, ok := link.(RequestAnnotator); ok {
+			if ar := annotator.Annotate(r); ar != nil {
+				r = ar
+			}
 		}
 		// Process MoveTo.
 		c.varmu.Lock()
 		if c.next != "" {
+			c.jumps = append(c.jumps, [2]string{c.indexes[i], c.next})
 			i = c.names[c.next] - 1
 			c.next = ""
 		}
 		c.varmu.Unlock()
 	}
+	c.unwrapAll()
+	if closer, ok := wrapped.(io.Closer); ok && c.wrapfunc != nil {
+		closer.Close()
+	}
+	if dw != nil {
+		dw.settle()
+	}
+	if c.latewrite != LateWriteAllow && c.LastError() != nil {
+		rec.abort(c.lateWrite)
+	}
+	c.finish(w, r)
+	return
+}
+
+// runContext returns the context of r extended with provided values, the
+// chain and the run logger.
+func (c *Chain) runContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	c.varmu.Lock()
+	for k, v := range c.provided {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	c.varmu.Unlock()
+	ctx = context.WithValue(ctx, chainKey{}, c)
+	return c.withRunLogger(ctx, r)
+}
+
+// Bind returns a shallow copy of r whose context carries the chain,
+// provided values and the run logger as during ServeHTTP. It allows
+// handlers that Unpack the chain to be executed directly, for instance
+// in unit tests. Bind does not reset the chain state.
+func (c *Chain) Bind(r *http.Request) *http.Request {
+	return r.Clone(context.WithValue(c.runContext(r), c.key, c))
+}
+
+// Pending returns the name of the handler chain execution will continue
+// on as set by MoveTo and true or an empty string and false if no move
+// is pending.
+func (c *Chain) Pending() (string, bool) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	return c.next, c.next != ""
+}
+
+// CompileChain returns a handler that executes a snapshot of handlers
+// currently registered in the chain sequentially, without any locking or
+// lookups, which makes it suitable for chains frozen after construction.
+//
+// The compiled handler does not put the chain in the request context,
+// does not check for errors and does not support MoveTo, Override,
+// finalizers, options or any changes made to the chain after compilation.
+// Nested Chains are compiled as well.
+func (c *Chain) CompileChain() http.Handler {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	links := make([]http.Handler, 0, len(c.links))
+	for _, link := range c.links {
+		if chain, ok := link.(*Chain); ok {
+			link = chain.CompileChain()
+		}
+		links = append(links, link)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, link := range links {
+			link.ServeHTTP(w, r)
+		}
+	})
+}
+
+// chainKey is the context key under which ServeHTTP stores the chain
+// regardless of the user key.
+type chainKey struct{}
+
+// FromContext returns the innermost chain executing a request with
+// context ctx and a truth if it exists. Unlike Unpack it does not require
+// the key the chain was created with; chains are stored in the request
+// context under a private key in addition to their own key.
+func FromContext(ctx context.Context) (chain *Chain, exists bool) {
+	chain, exists = ctx.Value(chainKey{}).(*Chain)
+	return
+}
+
+// afterRun registers fn to be called with LastError once the current
+// ServeHTTP call finishes executing handlers and finalizers.
+func (c *Chain) afterRun(fn func(err error)) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.afterrun = append(c.afterrun, fn)
 }
 
 // Unpack unpacks a chain from a request by key.
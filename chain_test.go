@@ -6,10 +6,15 @@ package chainer
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/vedranvuk/testex"
 )
@@ -104,7 +109,61 @@ func TestRegistration(t *testing.T) {
 	c := New(testkey)
 	checkchain(c)
 	clone := c.Clone()
-	checkchain(clone)
+	names := clone.Names()
+	if len(names) != len(reggedhandlers) {
+		t.Fatal("Clone() failed")
+	}
+	for index, name := range names {
+		if name != reggedhandlers[index] {
+			t.Fatal("Clone() failed")
+		}
+		if i, ok := clone.IndexOf(name); !ok || i != index {
+			t.Fatal("Clone() failed")
+		}
+		if err := clone.Append(name, MakeHandler(name)); !errors.Is(err, ErrDupName) {
+			t.Fatal("Clone() failed")
+		}
+	}
+	checkchain(New(testkey))
+}
+
+func TestCloneWithKey(t *testing.T) {
+
+	const otherkey = "other"
+	unpacks := func(key interface{}) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain, exists := Unpack(r, key)
+			if !exists {
+				t.Fatal("Unpack() failed")
+			}
+			_, nested := chain.IndexOf("n1")
+			fmt.Fprintf(w, "%v:%t;", chain.key, nested)
+		})
+	}
+	nested := New(testkey)
+	nested.Append("n1", unpacks(testkey))
+	c := New(testkey)
+	c.Append("h1", unpacks(testkey))
+	c.Append("nested", nested)
+
+	clone := c.CloneWithKey(otherkey)
+	clone.Override("h1", unpacks(otherkey))
+	_, h, _ := clone.GetAt(1)
+	h.(*Chain).Override("n1", unpacks(otherkey))
+
+	rec := httptest.NewRecorder()
+	clone.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "other:false;other:true;" {
+		t.Fatal("CloneWithKey() failed")
+	}
+	if _, h, _ := c.GetAt(1); h != nested || nested.key != testkey {
+		t.Fatal("CloneWithKey() modified original")
+	}
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "chainer:false;chainer:true;" {
+		t.Fatal("CloneWithKey() modified original")
+	}
 }
 
 func TestChain(t *testing.T) {
@@ -239,3 +298,1122 @@ FakeResponseWriter: Handler 'Child Handler 2' is setting an error!
 		t.Fatal("TestNested() failed")
 	}
 }
+
+func TestOverride(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'h2 override' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+`
+
+	buf := bytes.NewBuffer(nil)
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.Override("non-existent handler", MakeHandler("nope")); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("Override() failed")
+	}
+	if err := c.Override("h2", MakeHandler("h2 override")); err != nil {
+		t.Fatal(err)
+	}
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestOverride() failed")
+	}
+}
+
+func TestOnSuccessOnFailure(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'commit' reporting in.
+FakeResponseWriter: Handler 'h1' is setting an error!
+FakeResponseWriter: Handler 'rollback' reporting in.
+`
+
+	buf := bytes.NewBuffer(nil)
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	if err := c.OnSuccess("commit", MakeHandler("commit")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.OnSuccess("commit", MakeHandler("commit")); !errors.Is(err, ErrDupName) {
+		t.Fatal("OnSuccess() failed")
+	}
+	if err := c.OnFailure("rollback", MakeHandler("rollback")); err != nil {
+		t.Fatal(err)
+	}
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	c.Override("h1", MakeHandlerThatSetsAnError("h1"))
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestOnSuccessOnFailure() failed")
+	}
+}
+
+type testBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (tb *testBody) Close() error {
+	tb.closed = true
+	return nil
+}
+
+func TestDrainBody(t *testing.T) {
+
+	body := &testBody{Reader: strings.NewReader("unread request body")}
+	req, err := http.NewRequest("POST", "/", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(testkey, WithDrainBody())
+	c.Append("h1", MakeHandler("h1"))
+	c.ServeHTTP(testex.NewFakeResponseWriter(bytes.NewBuffer(nil)), req)
+	if body.Len() != 0 || !body.closed {
+		t.Fatal("TestDrainBody() failed")
+	}
+}
+
+func TestCompileChain(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'nested h1' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+`
+
+	buf := bytes.NewBuffer(nil)
+	nc := New(testkey)
+	nc.Append("nested h1", MakeHandler("nested h1"))
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("nested", nc)
+	c.Append("h2", MakeHandler("h2"))
+	h := c.CompileChain()
+	c.Append("h3", MakeHandler("h3"))
+	h.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestCompileChain() failed")
+	}
+}
+
+func makeBenchmarkChain() *Chain {
+	c := New(testkey)
+	for i := 0; i < 10; i++ {
+		c.Append(fmt.Sprintf("h%d", i), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	}
+	return c
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	c := makeBenchmarkChain()
+	w, r := httptest.NewRecorder(), MakeRequest("/")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkCompileChain(b *testing.B) {
+	h := makeBenchmarkChain().CompileChain()
+	w, r := httptest.NewRecorder(), MakeRequest("/")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, r)
+	}
+}
+
+type testProvideKey struct{}
+
+func TestProvide(t *testing.T) {
+
+	var got []interface{}
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Context().Value(testProvideKey{}))
+	}))
+	c.Provide(testProvideKey{}, "db handle")
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	c.Clone().ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(got) != 2 || got[0] != "db handle" || got[1] != "db handle" {
+		t.Fatal("Provide() failed")
+	}
+}
+
+type testAnnotatorKey struct{}
+
+type testAnnotator struct{}
+
+func (ta *testAnnotator) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (ta *testAnnotator) Annotate(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), testAnnotatorKey{}, "annotated"))
+}
+
+func TestRequestAnnotator(t *testing.T) {
+
+	var got interface{}
+	var unpacked bool
+	c := New(testkey)
+	c.Append("annotator", &testAnnotator{})
+	c.Append("reader", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value(testAnnotatorKey{})
+		_, unpacked = Unpack(r, testkey)
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if got != "annotated" || !unpacked {
+		t.Fatal("TestRequestAnnotator() failed")
+	}
+}
+
+func TestReset(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.Set("var", 42)
+	c.ServeHTTP(testex.NewFakeResponseWriter(bytes.NewBuffer(nil)), makeRequest("/"))
+	if c.LastError() == nil || len(c.LastRun().Trace) != 2 {
+		t.Fatal("TestReset() failed")
+	}
+	c.MoveTo("h1")
+	c.Reset()
+	if c.LastError() != nil || len(c.LastRun().Trace) != 0 || c.next != "" {
+		t.Fatal("Reset() failed")
+	}
+	if v, ok := c.Get("var"); !ok || v != 42 || len(c.Names()) != 2 {
+		t.Fatal("Reset() failed")
+	}
+}
+
+func TestInitVars(t *testing.T) {
+
+	logger := &testLogger{}
+	flags := []byte("ab")
+	c := New(testkey, WithVars(map[string]interface{}{"tenant": 1, "flags": flags}), WithLogger(logger))
+	flags[0] = 'x'
+	if v, _ := c.Get("tenant"); v != 1 {
+		t.Fatal("WithVars() failed")
+	}
+	if v, _ := c.Get("flags"); string(v.([]byte)) != "ab" {
+		t.Fatal("WithVars() failed to copy")
+	}
+	c.InitVars(map[string]interface{}{"tenant": 2})
+	if v, _ := c.Get("tenant"); v != 2 || len(logger.lines) != 0 {
+		t.Fatal("InitVars() failed")
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	c.InitVars(map[string]interface{}{"tenant": 3})
+	if v, _ := c.Get("tenant"); v != 3 || len(logger.lines) != 1 ||
+		logger.lines[0] != "chainer: InitVars called after the chain started serving" {
+		t.Fatal("InitVars() failed to warn")
+	}
+}
+
+func TestWith(t *testing.T) {
+
+	var x, y interface{}
+	c := New(testkey).With("x", 1).With("y", "two")
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := Unpack(r, testkey)
+		x, _ = chain.Get("x")
+		y, _ = chain.Get("y")
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	if x != 1 || y != "two" {
+		t.Fatal("With() failed")
+	}
+}
+
+func TestExportImportVars(t *testing.T) {
+
+	type ref struct{ n int }
+
+	shared := &ref{1}
+	src := New(testkey)
+	src.Set("int", 42)
+	src.Set("bytes", []byte("abc"))
+	src.Set("map", map[string]interface{}{"list": []interface{}{"a", "b"}})
+	src.Set("ref", shared)
+
+	dst := New(testkey)
+	dst.ImportVars(src.ExportVars())
+
+	src.Set("int", 0)
+	bytesvar, _ := src.Get("bytes")
+	bytesvar.([]byte)[0] = 'x'
+	mapvar, _ := src.Get("map")
+	mapvar.(map[string]interface{})["list"].([]interface{})[0] = "x"
+	shared.n = 2
+
+	if v, _ := dst.Get("int"); v != 42 {
+		t.Fatal("ImportVars() failed")
+	}
+	if v, _ := dst.Get("bytes"); string(v.([]byte)) != "abc" {
+		t.Fatal("ExportVars() failed to deep copy")
+	}
+	if v, _ := dst.Get("map"); v.(map[string]interface{})["list"].([]interface{})[0] != "a" {
+		t.Fatal("ExportVars() failed to deep copy")
+	}
+	if v, _ := dst.Get("ref"); v.(*ref).n != 2 {
+		t.Fatal("ExportVars() failed to copy by reference")
+	}
+}
+
+func TestIsRunning(t *testing.T) {
+
+	var running bool
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := Unpack(r, testkey)
+		running = chain.IsRunning()
+	}))
+	if c.IsRunning() {
+		t.Fatal("IsRunning() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if !running || c.IsRunning() {
+		t.Fatal("IsRunning() failed")
+	}
+}
+
+func TestMaxVarSize(t *testing.T) {
+
+	c := New(testkey, WithMaxVarSize(2))
+	if c.VarCount() != 0 {
+		t.Fatal("VarCount() failed")
+	}
+	if err := c.Set("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("b", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("c", 3); !errors.Is(err, ErrTooManyVars) {
+		t.Fatal("Set() failed")
+	}
+	if err := c.Set("a", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImportVars(map[string]interface{}{"b": 5, "d": 6}); !errors.Is(err, ErrTooManyVars) {
+		t.Fatal("ImportVars() failed")
+	}
+	if v, _ := c.Get("b"); v != 2 || c.VarCount() != 2 {
+		t.Fatal("VarCount() failed")
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	if index, ok := c.IndexOf("h2"); !ok || index != 1 {
+		t.Fatal("IndexOf() failed")
+	}
+	if index, ok := c.IndexOf("h3"); ok || index != 0 {
+		t.Fatal("IndexOf() failed")
+	}
+}
+
+func TestEntryPoint(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+`
+
+	buf := bytes.NewBuffer(nil)
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.SetEntryPoint("/two", "h2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEntryPoint("/three", "h3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEntryPoint("/four", "h4"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("SetEntryPoint() failed")
+	}
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/two"))
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/three"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestEntryPoint() failed")
+	}
+}
+
+func TestGetAt(t *testing.T) {
+
+	h2 := newTestHandler("h2")
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", h2)
+	if name, h, ok := c.GetAt(1); !ok || name != "h2" || h != h2 {
+		t.Fatal("GetAt() failed")
+	}
+	for _, index := range []int{-1, 2} {
+		if name, h, ok := c.GetAt(index); ok || name != "" || h != nil {
+			t.Fatal("GetAt() failed")
+		}
+	}
+}
+
+func TestPop(t *testing.T) {
+
+	h3 := newTestHandler("h3")
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Pop()
+	c.Append("h3", h3)
+	if name, h, ok := c.Pop(); !ok || name != "h3" || h != h3 {
+		t.Fatal("Pop() failed")
+	}
+	c.Append("h2", MakeHandler("h2"))
+	if names := c.Names(); len(names) != 2 || names[0] != "h1" || names[1] != "h2" {
+		t.Fatal("Pop() failed")
+	}
+	c.Pop()
+	c.Pop()
+	if name, h, ok := c.Pop(); ok || name != "" || h != nil || len(c.Names()) != 0 {
+		t.Fatal("Pop() failed")
+	}
+}
+
+func TestAppendSlice(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	if err := c.AppendSlice([]NamedHandler{
+		{"h2", MakeHandler("h2")},
+		{"h1", MakeHandler("h1")},
+	}); !errors.Is(err, ErrDupName) || len(c.Names()) != 1 {
+		t.Fatal("AppendSlice() failed")
+	}
+	if err := c.AppendSlice([]NamedHandler{
+		{"h2", MakeHandler("h2")},
+		{"h2", MakeHandler("h2")},
+	}); !errors.Is(err, ErrDupName) || len(c.Names()) != 1 {
+		t.Fatal("AppendSlice() failed")
+	}
+	if err := c.AppendSlice([]NamedHandler{
+		{"h4", MakeHandler("h4")},
+		{"h2", MakeHandler("h2")},
+		{"h3", MakeHandler("h3")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names := c.Names(); strings.Join(names, ",") != "h1,h4,h2,h3" {
+		t.Fatal("AppendSlice() failed")
+	}
+}
+
+func TestSplice(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'm1' reporting in.
+FakeResponseWriter: Handler 'm2' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+`
+
+	mw := New(testkey)
+	mw.Append("m1", MakeHandler("m1"))
+	mw.Append("m2", MakeHandler("m2"))
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.Splice(4, mw); !errors.Is(err, ErrInvalidIndex) {
+		t.Fatal("Splice() failed")
+	}
+	if err := c.Splice(1, mw); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Splice(0, mw); !errors.Is(err, ErrDupName) || len(c.Names()) != 5 {
+		t.Fatal("Splice() failed")
+	}
+	if i, ok := c.IndexOf("h3"); !ok || i != 4 {
+		t.Fatal("Splice() failed")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if string(buf.Bytes()) != want {
+		t.Fatal("Splice() failed")
+	}
+	if len(mw.Names()) != 2 {
+		t.Fatal("Splice() failed")
+	}
+}
+
+func TestNewFromHandlers(t *testing.T) {
+
+	c, err := NewFromHandlers(testkey,
+		NamedHandler{"h1", MakeHandler("h1")},
+		NamedHandler{"h2", MakeHandler("h2")},
+	)
+	if err != nil || strings.Join(c.Names(), ",") != "h1,h2" {
+		t.Fatal("NewFromHandlers() failed")
+	}
+	c, err = NewFromHandlers(testkey,
+		NamedHandler{"h1", MakeHandler("h1")},
+		NamedHandler{"h1", MakeHandler("h1")},
+	)
+	if !errors.Is(err, ErrDupName) || c != nil {
+		t.Fatal("NewFromHandlers() failed")
+	}
+}
+
+func TestStrict(t *testing.T) {
+
+	mustPanic := func(what string, fn func()) {
+		defer func() {
+			err, ok := recover().(error)
+			if !ok || !errors.Is(err, ErrChainer) {
+				t.Fatalf("WithStrict() failed to panic on %s", what)
+			}
+		}()
+		fn()
+	}
+
+	c := New(testkey, WithStrict())
+	c.Append("h1", MakeHandler("h1"))
+	mustPanic("duplicate name", func() { c.Append("h1", MakeHandler("h1")) })
+	mustPanic("invalid MoveTo", func() { c.MoveTo("h2") })
+	if len(c.Names()) != 1 {
+		t.Fatal("WithStrict() failed")
+	}
+
+	c = New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	if err := c.Append("h1", MakeHandler("h1")); !errors.Is(err, ErrDupName) {
+		t.Fatal("Append() failed")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+
+	type otherKey struct{}
+
+	var got, gotInner *Chain
+	inner := New(otherKey{})
+	inner.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotInner, _ = FromContext(r.Context())
+	}))
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+	c.Append("inner", inner)
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if got != c || gotInner != inner {
+		t.Fatal("FromContext() failed")
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("FromContext() failed")
+	}
+}
+
+func TestSortBy(t *testing.T) {
+
+	c := New(testkey)
+	for _, name := range []string{"charlie", "alpha", "delta", "bravo"} {
+		c.Append(name, MakeHandler(name))
+	}
+	c.SortBy(func(a, b string) bool { return a < b })
+	if names := c.Names(); strings.Join(names, ",") != "alpha,bravo,charlie,delta" {
+		t.Fatal("SortBy() failed")
+	}
+	if i, ok := c.IndexOf("charlie"); !ok || i != 2 {
+		t.Fatal("SortBy() failed to reindex")
+	}
+}
+
+func TestAppendDynamic(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.AppendDynamic("dynamic", func(r *http.Request) http.Handler {
+		switch r.URL.Path {
+		case "/a":
+			return MakeHandler("a")
+		case "/b":
+			return MakeHandler("b")
+		}
+		return nil
+	})
+	c.Append("h2", MakeHandler("h2"))
+
+	for path, want := range map[string]string{
+		"/a": "h1,a,h2",
+		"/b": "h1,b,h2",
+		"/":  "h1,h2",
+	} {
+		buf := bytes.NewBuffer(nil)
+		c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest(path))
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			got = append(got, strings.Split(line, "'")[1])
+		}
+		if strings.Join(got, ",") != want {
+			t.Fatalf("AppendDynamic() failed for '%s'", path)
+		}
+	}
+}
+
+func TestAppendMethod(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'get' reporting in.
+FakeResponseWriter: Handler 'h3' reporting in.
+`
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.AppendMethod("GET", "get", MakeHandler("get"))
+	c.AppendMethod("POST", "post", MakeHandler("post"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.AppendMethod("PUT", "h3", MakeHandler("put")); !errors.Is(err, ErrDupName) {
+		t.Fatal("AppendMethod() failed")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestAppendMethod() failed")
+	}
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/", nil)
+	c.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST" {
+		t.Fatal("TestAppendMethod() failed")
+	}
+	if !errors.Is(c.LastError(), ErrMethodNotAllowed) {
+		t.Fatal("TestAppendMethod() failed")
+	}
+}
+
+func TestShift(t *testing.T) {
+
+	h1 := newTestHandler("h1")
+	c := New(testkey)
+	c.Append("h1", h1)
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if name, h, ok := c.Shift(); !ok || name != "h1" || h != h1 {
+		t.Fatal("Shift() failed")
+	}
+	if index, ok := c.IndexOf("h3"); !ok || index != 1 {
+		t.Fatal("Shift() failed to reindex")
+	}
+	if names := c.Names(); len(names) != 2 || names[0] != "h2" {
+		t.Fatal("Shift() failed")
+	}
+	c.Shift()
+	c.Shift()
+	if name, h, ok := c.Shift(); ok || name != "" || h != nil {
+		t.Fatal("Shift() failed")
+	}
+}
+
+func TestErrorTransformer(t *testing.T) {
+
+	errGeneric := errors.New("internal error")
+	c := New(testkey)
+	c.Append("h1", MakeHandlerThatSetsAnError("h1"))
+	c.SetErrorTransformer(func(err error) error {
+		if strings.Contains(err.Error(), "h1") {
+			return errGeneric
+		}
+		return err
+	})
+	c.ServeHTTP(testex.NewFakeResponseWriter(bytes.NewBuffer(nil)), makeRequest("/"))
+	if c.LastError() != errGeneric {
+		t.Fatal("SetErrorTransformer() failed")
+	}
+	c.SetErrorTransformer(nil)
+	c.ServeHTTP(testex.NewFakeResponseWriter(bytes.NewBuffer(nil)), makeRequest("/"))
+	if c.LastError() == errGeneric {
+		t.Fatal("SetErrorTransformer() failed")
+	}
+}
+
+func TestReorder(t *testing.T) {
+
+	const want = `FakeResponseWriter: Handler 'h3' reporting in.
+FakeResponseWriter: Handler 'h1' reporting in.
+FakeResponseWriter: Handler 'h2' reporting in.
+`
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.Reorder([]string{"h1", "h2"}); !errors.Is(err, ErrNameCount) {
+		t.Fatal("Reorder() failed")
+	}
+	if err := c.Reorder([]string{"h1", "h2", "h4"}); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("Reorder() failed")
+	}
+	if err := c.Reorder([]string{"h1", "h2", "h2"}); !errors.Is(err, ErrDupName) {
+		t.Fatal("Reorder() failed")
+	}
+	if err := c.Reorder([]string{"h3", "h1", "h2"}); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := c.IndexOf("h2"); index != 2 {
+		t.Fatal("Reorder() failed to reindex")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.ServeHTTP(testex.NewFakeResponseWriter(buf), makeRequest("/"))
+	if verbose {
+		fmt.Printf(string(buf.Bytes()))
+	}
+	if string(buf.Bytes()) != want {
+		t.Fatal("TestReorder() failed")
+	}
+}
+
+type testScope map[string]interface{}
+
+func (ts testScope) Get(key string) (interface{}, bool) {
+	val, ok := ts[key]
+	return val, ok
+}
+
+func (ts testScope) Set(key string, val interface{}) error {
+	ts[key] = val
+	return nil
+}
+
+func TestServeWithScope(t *testing.T) {
+
+	var got interface{}
+	c := New(testkey)
+	c.Append("writer", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := Unpack(r, testkey)
+		previous, _ := chain.Get("stage")
+		chain.Set("stage", fmt.Sprintf("%v+writer", previous))
+	}))
+	c.Append("reader", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := Unpack(r, testkey)
+		got, _ = chain.Get("stage")
+	}))
+
+	scope := testScope{"stage": "previous"}
+	c.ServeWithScope(scope, httptest.NewRecorder(), MakeRequest("/"))
+	if got != "previous+writer" || scope["stage"] != "previous+writer" {
+		t.Fatal("ServeWithScope() failed")
+	}
+	if c.VarCount() != 0 {
+		t.Fatal("ServeWithScope() failed to bypass chain vars")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if got != "<nil>+writer" || c.VarCount() != 1 {
+		t.Fatal("ServeWithScope() failed to restore chain vars")
+	}
+}
+
+func TestAppendPrefix(t *testing.T) {
+
+	var paths []string
+	sub := New(testkey)
+	sub.Append("recorder", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/fail" {
+			chain, _ := Unpack(r, testkey)
+			chain.SetError(errors.New("sub failed"))
+		}
+	}))
+	c := New(testkey)
+	if err := c.AppendPrefix("/api", sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AppendPrefix("/api", sub); !errors.Is(err, ErrDupName) {
+		t.Fatal("AppendPrefix() failed")
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/api/users"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/web/users"))
+	if len(paths) != 1 || paths[0] != "/users" || c.LastError() != nil {
+		t.Fatal("AppendPrefix() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/api/fail"))
+	if c.LastError() == nil {
+		t.Fatal("AppendPrefix() failed to propagate error")
+	}
+}
+
+func TestWasExecuted(t *testing.T) {
+
+	c := New(testkey)
+	if c.WasExecuted() {
+		t.Fatal("WasExecuted() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if !c.WasExecuted() {
+		t.Fatal("WasExecuted() failed")
+	}
+	c.Reset()
+	if c.WasExecuted() {
+		t.Fatal("WasExecuted() failed after Reset()")
+	}
+}
+
+func TestServeHTTPAndCapture(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.Append("h3", MakeHandler("h3"))
+
+	const want = "Handler 'h1' reporting in.\nHandler 'h2' is setting an error!\n"
+	rec := httptest.NewRecorder()
+	code, body, err := c.ServeHTTPAndCapture(rec, MakeRequest("/"))
+	if code != http.StatusOK || string(body) != want || err == nil {
+		t.Fatal("ServeHTTPAndCapture() failed")
+	}
+	if rec.Body.String() != want {
+		t.Fatal("ServeHTTPAndCapture() failed to copy response")
+	}
+	if _, _, err := New(testkey).ServeHTTPAndCapture(nil, MakeRequest("/")); err != nil {
+		t.Fatal("ServeHTTPAndCapture() failed")
+	}
+}
+
+func TestTimeoutHandler(t *testing.T) {
+
+	var (
+		after    int32
+		writeerr error
+		done     = make(chan struct{})
+	)
+	c := New(testkey, WithLateWrite(LateWritePanic))
+	c.Append("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, writeerr = w.Write([]byte("too late"))
+	}))
+	c.Append("after", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&after, 1)
+	}))
+	c.DeferHandler("done", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(done)
+	}))
+
+	rec := httptest.NewRecorder()
+	http.TimeoutHandler(c, 10*time.Millisecond, "timeout").ServeHTTP(rec, MakeRequest("/"))
+	<-done
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "timeout" {
+		t.Fatal("TimeoutHandler failed")
+	}
+	if writeerr != http.ErrHandlerTimeout || atomic.LoadInt32(&after) != 0 {
+		t.Fatal("chain did not stop on timeout")
+	}
+	if res := c.LastRun(); !errors.Is(res.Err, ErrHandlerTimeout) || len(res.Trace) != 1 {
+		t.Fatal("LastRun() does not reflect timeout")
+	}
+}
+
+func TestInjectBefore(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.SetEntryPoint("/two", "h2"); err != nil {
+		t.Fatal(err)
+	}
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "Injected: ")
+			next.ServeHTTP(w, r)
+		})
+	}
+	if err := c.InjectBefore("h2", "auth", mw); err != nil {
+		t.Fatal("InjectBefore() failed")
+	}
+	if err := c.InjectBefore("h2", "x", mw); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("InjectBefore() failed")
+	}
+	if err := c.InjectBefore("h3", "h1", mw); !errors.Is(err, ErrDupName) {
+		t.Fatal("InjectBefore() failed")
+	}
+	if names := c.Names(); strings.Join(names, ",") != "h1,auth,h3" {
+		t.Fatal("InjectBefore() failed")
+	}
+
+	const want = "Handler 'h1' reporting in.\nInjected: Handler 'h2' reporting in.\nHandler 'h3' reporting in.\n"
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want {
+		t.Fatal("InjectBefore() failed")
+	}
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/two"))
+	if rec.Body.String() != want[len("Handler 'h1' reporting in.\n"):] {
+		t.Fatal("InjectBefore() failed to update entry point")
+	}
+}
+
+func TestGroupWith(t *testing.T) {
+
+	const want = `Handler 'h1' reporting in.
+Handler 'mw1' reporting in.
+Handler 'mw2' reporting in.
+Handler 'g1' reporting in.
+Handler 'g2' is setting an error!
+`
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	err := c.GroupWith("group", []http.Handler{MakeHandler("mw1"), MakeHandler("mw2")}, func(sub *Chain) {
+		sub.Append("g1", MakeHandler("g1"))
+		sub.Append("g2", MakeHandlerThatSetsAnError("g2"))
+		sub.Append("g3", MakeHandler("g3"))
+	})
+	if err != nil {
+		t.Fatal("GroupWith() failed")
+	}
+	c.Append("h2", MakeHandler("h2"))
+	if err := c.GroupWith("group", nil, nil); !errors.Is(err, ErrDupName) {
+		t.Fatal("GroupWith() failed")
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want || c.LastError() == nil {
+		t.Fatal("GroupWith() failed")
+	}
+}
+
+func TestWatchVars(t *testing.T) {
+
+	var log1, log2 []string
+	c := New(testkey)
+	c.WatchVars(func(op string, key string, val interface{}) {
+		log1 = append(log1, fmt.Sprintf("%s %s %v", op, key, val))
+	})
+	c.WatchVars(func(op string, key string, val interface{}) {
+		log2 = append(log2, fmt.Sprintf("%s %s %v", op, key, val))
+	})
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Set("a", 1)
+		c.Set("b", "two")
+		if val, ok := c.Delete("a"); !ok || val != 1 {
+			t.Fatal("Delete() failed")
+		}
+		if _, ok := c.Delete("a"); ok {
+			t.Fatal("Delete() failed")
+		}
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+
+	const want = "set a 1,set b two,delete a 1"
+	if strings.Join(log1, ",") != want || strings.Join(log2, ",") != want {
+		t.Fatal("WatchVars() failed")
+	}
+	if _, ok := c.Get("a"); ok || c.VarCount() != 1 {
+		t.Fatal("Delete() failed")
+	}
+
+	c = New(testkey, WithMaxVarSize(1))
+	log1 = nil
+	c.WatchVars(func(op string, key string, val interface{}) {
+		log1 = append(log1, fmt.Sprintf("%s %s %v", op, key, val))
+	})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if strings.Join(log1, ",") != "set a 1" {
+		t.Fatal("WatchVars() reported failed Set")
+	}
+}
+
+func TestSetOnErrorAfterWrite(t *testing.T) {
+
+	type warning struct {
+		name    string
+		written int64
+	}
+	var warnings []warning
+	c := New(testkey)
+	c.SetOnErrorAfterWrite(10, func(name string, written int64, err error) {
+		warnings = append(warnings, warning{name, written})
+	})
+	c.Append("writer", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	c.Append("small", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("01234"))
+		chain, _ := Unpack(r, testkey)
+		chain.SetError(errors.New("small"))
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(warnings) != 0 {
+		t.Fatal("SetOnErrorAfterWrite() failed, counted bytes of previous handlers")
+	}
+
+	c.Override("small", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 12)))
+		chain, _ := Unpack(r, testkey)
+		chain.SetError(errors.New("large"))
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(warnings) != 1 || warnings[0].name != "small" || warnings[0].written != 12 {
+		t.Fatalf("SetOnErrorAfterWrite() failed: %v", warnings)
+	}
+}
+
+func TestSetOnFirstError(t *testing.T) {
+
+	var calls []string
+	c := New(testkey)
+	c.SetOnFirstError(func(err error, name string) {
+		calls = append(calls, name+": "+err.Error())
+	})
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.OnFailure("cleanup", MakeHandlerThatSetsAnError("cleanup"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+
+	const want = "h2: Handler 'h2' error.,h2: Handler 'h2' error."
+	if strings.Join(calls, ",") != want {
+		t.Fatalf("SetOnFirstError() failed: %v", calls)
+	}
+}
+
+func TestBind(t *testing.T) {
+
+	type providedKey struct{}
+	c := New(testkey)
+	c.Provide(providedKey{}, "value")
+	c.Append("h1", MakeHandler("h1"))
+	r := c.Bind(MakeRequest("/"))
+	if chain, ok := Unpack(r, testkey); !ok || chain != c {
+		t.Fatal("Bind() failed")
+	}
+	if inner, ok := FromContext(r.Context()); !ok || inner != c || r.Context().Value(providedKey{}) != "value" {
+		t.Fatal("Bind() failed")
+	}
+	MakeHandlerThatSetsAnError("direct").ServeHTTP(httptest.NewRecorder(), r)
+	if c.LastError() == nil {
+		t.Fatal("Bind() failed")
+	}
+	if _, pending := c.Pending(); pending {
+		t.Fatal("Pending() failed")
+	}
+	c.MoveTo("h1")
+	if name, pending := c.Pending(); !pending || name != "h1" {
+		t.Fatal("Pending() failed")
+	}
+}
+
+func TestFind(t *testing.T) {
+
+	c := New(testkey)
+	for _, name := range []string{"auth:basic", "debug:dump", "auth:token", "serve", "debug:trace"} {
+		c.Append(name, MakeHandler(name))
+	}
+	for pattern, want := range map[string]string{
+		"auth:*":  "auth:basic,auth:token",
+		"debug:*": "debug:dump,debug:trace",
+		"*:t*":    "auth:token,debug:trace",
+		"serve":   "serve",
+		"none:*":  "",
+		"[":       "",
+	} {
+		if got := strings.Join(c.Find(pattern), ","); got != want {
+			t.Fatalf("Find(%q) failed: %s", pattern, got)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+
+	c := New(testkey)
+	c.Set("var", 1)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.SetEntryPoint("/two", "h2")
+
+	mapped := c.Map(func(name string, h http.Handler) (string, http.Handler) {
+		if name == "h2" {
+			return "stub", MakeHandler("stub")
+		}
+		return "", MakeMiddleware(name)(h)
+	})
+	if strings.Join(mapped.Names(), ",") != "h1,stub,h3" || mapped.VarCount() != 0 {
+		t.Fatal("Map() failed")
+	}
+
+	const want = "Handler 'stub' reporting in.\nMiddleware 'h3' before.\nHandler 'h3' reporting in.\nMiddleware 'h3' after.\n"
+	rec := httptest.NewRecorder()
+	mapped.ServeHTTP(rec, MakeRequest("/two"))
+	if rec.Body.String() != want {
+		t.Fatalf("Map() failed: %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/two"))
+	if rec.Body.String() != "Handler 'h2' reporting in.\nHandler 'h3' reporting in.\n" || c.VarCount() != 1 {
+		t.Fatal("Map() modified original")
+	}
+
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrDupName) {
+			t.Fatal("Map() failed to panic")
+		}
+	}()
+	c.Map(func(name string, h http.Handler) (string, http.Handler) { return "same", h })
+}
+
+func TestContains(t *testing.T) {
+
+	nested := New(testkey)
+	redirect := http.RedirectHandler("/", http.StatusFound)
+	fn := MakeHandler("fn")
+	c := New(testkey)
+	c.Append("nested", nested)
+	c.Append("redirect", redirect)
+	c.Append("fn", fn)
+
+	if !c.Contains(nested) || !c.Contains(redirect) {
+		t.Fatal("Contains() failed")
+	}
+	if c.Contains(New(testkey)) || c.Contains(http.RedirectHandler("/", http.StatusFound)) {
+		t.Fatal("Contains() failed")
+	}
+	if c.Contains(fn) {
+		t.Fatal("Contains() failed for uncomparable handler")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// Package chaintest provides utilities for testing chain handlers in
+// isolation.
+//
+// A handler that unpacks its chain from the request can be executed
+// directly, without serving a whole chain, using a request returned by
+// Wrap. Effects of the handler on the chain can be inspected afterwards:
+//
+//	r := chaintest.Wrap(httptest.NewRequest("GET", "/", nil), key, func(c *chainer.Chain) {
+//		c.Set("user", "bob")
+//	})
+//	handler.ServeHTTP(httptest.NewRecorder(), r)
+//	if err := chaintest.Err(r, key); err != nil {
+//		...
+//	}
+package chaintest
+
+import (
+	"net/http"
+
+	"github.com/vedranvuk/chainer"
+)
+
+// Wrap returns a copy of r whose context carries a new, empty chain under
+// key as it would during ServeHTTP. If setup is not nil it is called with
+// the chain before binding it to the request, for instance to set
+// variables or to register handler names so that MoveTo validates them.
+func Wrap(r *http.Request, key interface{}, setup func(*chainer.Chain)) *http.Request {
+	c := chainer.New(key)
+	if setup != nil {
+		setup(c)
+	}
+	return c.Bind(r)
+}
+
+// Chain returns the chain carried by r under key or nil if r was not
+// returned by Wrap with key.
+func Chain(r *http.Request, key interface{}) *chainer.Chain {
+	c, _ := chainer.Unpack(r, key)
+	return c
+}
+
+// Err returns the error set on the chain carried by r under key.
+func Err(r *http.Request, key interface{}) error {
+	if c := Chain(r, key); c != nil {
+		return c.LastError()
+	}
+	return nil
+}
+
+// Next returns the name of the handler set by MoveTo on the chain carried
+// by r under key or an empty string if none was set.
+func Next(r *http.Request, key interface{}) string {
+	if c := Chain(r, key); c != nil {
+		name, _ := c.Pending()
+		return name
+	}
+	return ""
+}
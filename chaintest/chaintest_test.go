@@ -0,0 +1,66 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chaintest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vedranvuk/chainer"
+)
+
+const testkey = "chainer"
+
+// errorHandler sets an error on its chain.
+var errorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	chain, exists := chainer.Unpack(r, testkey)
+	if !exists {
+		panic("nope")
+	}
+	chain.SetError(errors.New("failed"))
+})
+
+// moveHandler moves to the handler named by the "next" variable.
+var moveHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	chain, _ := chainer.Unpack(r, testkey)
+	next, _ := chain.Get("next")
+	if err := chain.MoveTo(next.(string)); err != nil {
+		fmt.Fprint(w, err)
+	}
+})
+
+func TestWrap(t *testing.T) {
+
+	r := Wrap(httptest.NewRequest("GET", "/", nil), testkey, nil)
+	errorHandler.ServeHTTP(httptest.NewRecorder(), r)
+	if err := Err(r, testkey); err == nil || err.Error() != "failed" {
+		t.Fatal("Err() failed")
+	}
+
+	r = Wrap(httptest.NewRequest("GET", "/", nil), testkey, func(c *chainer.Chain) {
+		c.Append("final", http.NotFoundHandler())
+		c.Set("next", "final")
+	})
+	moveHandler.ServeHTTP(httptest.NewRecorder(), r)
+	if Next(r, testkey) != "final" || Err(r, testkey) != nil {
+		t.Fatal("Next() failed")
+	}
+
+	r = Wrap(httptest.NewRequest("GET", "/", nil), testkey, func(c *chainer.Chain) {
+		c.Set("next", "missing")
+	})
+	rec := httptest.NewRecorder()
+	moveHandler.ServeHTTP(rec, r)
+	if Next(r, testkey) != "" || rec.Body.Len() == 0 {
+		t.Fatal("Next() failed")
+	}
+
+	if Chain(httptest.NewRequest("GET", "/", nil), testkey) != nil {
+		t.Fatal("Chain() failed")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+)
+
+// ErrNoCheckpoint is returned by RollbackTo if the checkpoint was not
+// passed in the current run.
+var ErrNoCheckpoint = ErrChainer.WrapFormat("checkpoint '%s' not reached")
+
+// Checkpoint appends a handler to the chain under name that writes
+// nothing and captures a snapshot of chain variables when executed.
+// RollbackTo restores variables to the snapshot. Snapshots are discarded
+// when the next run starts. If name is already registered ErrDupName
+// sibling is returned.
+//
+// Like ExportVars, snapshots capture the chain's own variables, not a
+// VarScope passed to ServeWithScope, and copy values as described by
+// ExportVars.
+func (c *Chain) Checkpoint(name string) error {
+	return c.Append(name, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The handler may be executing in a clone of c.
+		chain, exists := FromContext(r.Context())
+		if !exists {
+			chain = c
+		}
+		chain.varmu.Lock()
+		defer chain.varmu.Unlock()
+
+		if chain.snapshots == nil {
+			chain.snapshots = make(map[string]map[string]interface{})
+		}
+		chain.snapshots[chain.normalize(name)] = copyVars(chain.vars)
+	}))
+}
+
+// RollbackTo restores chain variables to the snapshot captured by the
+// checkpoint registered under name in the current run. It is meant to be
+// called from a handler executing in the chain. If the checkpoint was not
+// passed in the current run ErrNoCheckpoint sibling is returned.
+func (c *Chain) RollbackTo(name string) error {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	snapshot, exists := c.snapshots[c.normalize(name)]
+	if !exists {
+		return ErrNoCheckpoint.WrapArgs(name)
+	}
+	c.vars = copyVars(snapshot)
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+
+	c := New(testkey)
+	setter := func(key string, val interface{}) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Set(key, val)
+		})
+	}
+	c.Append("set a", setter("a", 1))
+	c.Checkpoint("first")
+	c.Append("set b", setter("b", 2))
+	c.Checkpoint("second")
+	c.Append("set c", setter("c", 3))
+	c.Append("rollback", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.RollbackTo("second"); err != nil {
+			t.Fatal("RollbackTo() failed")
+		}
+		if _, ok := c.Get("c"); ok || c.VarCount() != 2 {
+			t.Fatal("RollbackTo() failed")
+		}
+		if err := c.RollbackTo("first"); err != nil {
+			t.Fatal("RollbackTo() failed")
+		}
+		if err := c.RollbackTo("third"); !errors.Is(err, ErrNoCheckpoint) {
+			t.Fatal("RollbackTo() failed")
+		}
+	}))
+	if err := c.Checkpoint("first"); !errors.Is(err, ErrDupName) {
+		t.Fatal("Checkpoint() failed")
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if val, ok := c.Get("a"); !ok || val != 1 || c.VarCount() != 1 {
+		t.Fatal("RollbackTo() failed")
+	}
+	c.Set("d", 4)
+	// Snapshots persist until the next run starts.
+	if err := c.RollbackTo("first"); err != nil || c.VarCount() != 1 {
+		t.Fatal("RollbackTo() failed")
+	}
+}
+
+func TestCheckpointClone(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("set a", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := FromContext(r.Context())
+		chain.Set("a", 1)
+	}))
+	c.Checkpoint("first")
+	c.Append("set b", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := FromContext(r.Context())
+		chain.Set("b", 2)
+	}))
+
+	clone := c.Clone()
+	clone.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if err := c.RollbackTo("first"); !errors.Is(err, ErrNoCheckpoint) {
+		t.Fatal("Checkpoint() failed")
+	}
+	if err := clone.RollbackTo("first"); err != nil {
+		t.Fatal("RollbackTo() failed")
+	}
+	if val, ok := clone.Get("a"); !ok || val != 1 || clone.VarCount() != 1 {
+		t.Fatal("RollbackTo() failed")
+	}
+}
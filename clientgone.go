@@ -0,0 +1,79 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrClientGone is set as the chain error when the client disconnected
+// during a run of a chain with a hook set by OnClientGone.
+var ErrClientGone = ErrChainer.Wrap("client gone")
+
+// OnClientGone sets a function called when the context of a request being
+// served by the chain is cancelled because the client disconnected, with
+// the request and the name of the handler that was executing at the time
+// or an empty string if no handler was executing. Contexts that are done
+// because a deadline passed, such as one set by ServeWithDeadline, or
+// that were cancelled with a cause, such as by a parent chain created
+// with WithCancelOnError, are not reported.
+//
+// While fn is set, every run watches the request context in a goroutine
+// that exits when the run finishes. Once the context is done, fn is called
+// from that goroutine and the run is marked so that no further handlers
+// are executed; ErrClientGone is set as the chain error before the next
+// handler would be executed. fn must not call chain methods that share
+// the lock with ServeHTTP. A nil fn removes the function.
+// OnClientGone shares the lock with ServeHTTP.
+func (c *Chain) OnClientGone(fn func(r *http.Request, at string)) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.ongone = fn
+}
+
+// watchClient starts watching ctx of r for the duration of a run and
+// returns a function that stops watching and waits for the watcher to
+// exit. runmu must be locked by the caller.
+func (c *Chain) watchClient(ctx context.Context, r *http.Request) (stop func()) {
+	atomic.StoreInt32(&c.gone, 0)
+	done := ctx.Done()
+	if done == nil {
+		return func() {}
+	}
+	fn := c.ongone
+	quit, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-done:
+			if !clientCancelled(ctx) {
+				return
+			}
+			c.varmu.Lock()
+			at := c.current
+			c.varmu.Unlock()
+			atomic.StoreInt32(&c.gone, 1)
+			fn(r, at)
+		case <-quit:
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+	}
+}
+
+// clientGone returns true if the client of the current run is gone.
+func (c *Chain) clientGone() bool { return atomic.LoadInt32(&c.gone) != 0 }
+
+// clientCancelled returns true if done ctx was cancelled without a cause,
+// as http.Server does when the client disconnects, and not by a deadline
+// or a chain cancelling it with the chain error as the cause.
+func clientCancelled(ctx context.Context) bool {
+	return ctx.Err() == context.Canceled && context.Cause(ctx) == context.Canceled
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnClientGone(t *testing.T) {
+
+	goroutines := runtime.NumGoroutine()
+
+	var gone []string
+	hooked := make(chan struct{})
+	c := New(testkey)
+	c.OnClientGone(func(r *http.Request, at string) {
+		gone = append(gone, at)
+		close(hooked)
+	})
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		<-hooked
+	}))
+	c.Append("h3", MakeHandler("h3"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/").WithContext(ctx))
+	if len(gone) != 1 || gone[0] != "slow" {
+		t.Fatalf("OnClientGone() failed: %v", gone)
+	}
+	if !errors.Is(c.LastError(), ErrClientGone) || strings.Join(c.LastRun().Trace, ",") != "h1,slow" {
+		t.Fatal("OnClientGone() failed to stop the run")
+	}
+
+	// Runs that finish normally stop the watcher.
+	for i := 0; i < 10; i++ {
+		c.Override("slow", MakeHandler("slow"))
+		ctx, cancel := context.WithCancel(context.Background())
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/").WithContext(ctx))
+		cancel()
+	}
+	if c.LastError() != nil || len(gone) != 1 {
+		t.Fatal("OnClientGone() failed")
+	}
+	waitFor(t, func() bool { return runtime.NumGoroutine() <= goroutines })
+}
+
+func TestOnClientGoneChainCancel(t *testing.T) {
+
+	var gone int32
+	nested := New(testkey)
+	nested.OnClientGone(func(r *http.Request, at string) { atomic.AddInt32(&gone, 1) })
+	nested.Append("wait", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+	}))
+	nested.Append("h2", MakeHandler("h2"))
+
+	// Deadline of ServeWithDeadline.
+	nested.ServeWithDeadline(time.Now().Add(10*time.Millisecond), httptest.NewRecorder(), MakeRequest("/"))
+	if atomic.LoadInt32(&gone) != 0 || errors.Is(nested.LastError(), ErrClientGone) {
+		t.Fatal("OnClientGone() reported a deadline")
+	}
+
+	// Cancellation by a parent chain created with WithCancelOnError.
+	parent := New(testkey, WithCancelOnError())
+	parent.Append("error", MakeHandlerThatSetsAnError("error"))
+	parent.DeferHandler("nested", nested)
+	parent.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if atomic.LoadInt32(&gone) != 0 || errors.Is(nested.LastError(), ErrClientGone) {
+		t.Fatal("OnClientGone() reported a chain cancellation")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrCoalescedPanic is set as the chain error of requests waiting on a
+// coalesced handler execution that panicked.
+var ErrCoalescedPanic = ErrChainer.WrapFormat("coalesced handler '%s' panicked")
+
+// DefaultCoalesceLimit is the response size limit used by Coalesce if a
+// limit less than 1 is specified.
+const DefaultCoalesceLimit = 1 << 20
+
+// DefaultCoalesceHeaders are names of response headers replayed to
+// waiting requests by Coalesce if no headers are specified.
+var DefaultCoalesceHeaders = []string{
+	"Cache-Control",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+// CoalesceOptions are options of a handler returned by Coalesce.
+type CoalesceOptions struct {
+	// Limit is the size in bytes of the largest response that is
+	// coalesced. A limit less than 1 selects DefaultCoalesceLimit.
+	Limit int
+	// Headers are names of response headers replayed to waiting requests.
+	// Other headers, such as Set-Cookie, are specific to the request that
+	// executed the handler and are not replayed. If nil,
+	// DefaultCoalesceHeaders are replayed.
+	Headers []string
+}
+
+// coalescer executes a handler once for concurrent requests with the
+// same key.
+type coalescer struct {
+	name    string
+	keyFn   func(*http.Request) string
+	handler http.Handler
+	limit   int
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	// joined counts requests that found a running call and waited on it.
+	joined int64
+}
+
+// coalescedCall is an execution of a coalesced handler.
+type coalescedCall struct {
+	done chan struct{}
+
+	status int
+	header http.Header
+	body   bytes.Buffer
+	err    error
+	bypass bool
+}
+
+// Coalesce returns a handler named name that executes h once for
+// concurrent requests for which keyFn returns the same non-empty key. The
+// first request executes h while the others wait and receive a copy of its
+// response status, body and headers named by CoalesceOptions.Headers. The
+// chain error set by h, if any, is set as the chain error of all waiting
+// requests and their trace entry is annotated as "name→coalesced".
+//
+// Responses larger than CoalesceOptions.Limit bytes bypass coalescing:
+// they are streamed to the first request and waiting requests execute h
+// themselves. If h panics, waiting requests respond with 500 Internal
+// Server Error and ErrCoalescedPanic sibling as the chain error while the
+// panic propagates to the first request.
+//
+// A Chain serves one request at a time so the returned handler should be
+// shared by multiple chains, for instance clones of a chain.
+func Coalesce(name string, keyFn func(*http.Request) string, h http.Handler, opts CoalesceOptions) http.Handler {
+	if opts.Limit < 1 {
+		opts.Limit = DefaultCoalesceLimit
+	}
+	if opts.Headers == nil {
+		opts.Headers = DefaultCoalesceHeaders
+	}
+	return &coalescer{
+		name:    name,
+		keyFn:   keyFn,
+		handler: h,
+		limit:   opts.Limit,
+		headers: opts.Headers,
+		mu:      sync.Mutex{},
+		calls:   make(map[string]*coalescedCall),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (co *coalescer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := co.keyFn(r)
+	if key == "" {
+		co.handler.ServeHTTP(w, r)
+		return
+	}
+	co.mu.Lock()
+	if call, exists := co.calls[key]; exists {
+		atomic.AddInt64(&co.joined, 1)
+		co.mu.Unlock()
+		<-call.done
+		co.replay(call, w, r)
+		return
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	co.calls[key] = call
+	co.mu.Unlock()
+
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			call.status = http.StatusInternalServerError
+			call.header = nil
+			call.body.Reset()
+			call.bypass = false
+			call.err = ErrCoalescedPanic.WrapArgs(co.name)
+		}
+		co.mu.Lock()
+		delete(co.calls, key)
+		co.mu.Unlock()
+		close(call.done)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	co.handler.ServeHTTP(&coalesceWriter{ResponseWriter: w, call: call, limit: co.limit}, r)
+	if call.status == 0 {
+		call.status = http.StatusOK
+	}
+	call.header = make(http.Header, len(co.headers))
+	for _, name := range co.headers {
+		if values := w.Header().Values(name); len(values) > 0 {
+			call.header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	if chain, exists := FromContext(r.Context()); exists {
+		call.err = chain.LastError()
+	}
+}
+
+// replay writes the response of call to w and sets the chain error.
+func (co *coalescer) replay(call *coalescedCall, w http.ResponseWriter, r *http.Request) {
+	if call.bypass {
+		co.handler.ServeHTTP(w, r)
+		return
+	}
+	header := w.Header()
+	for k, v := range call.header {
+		header[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(call.status)
+	w.Write(call.body.Bytes())
+	if chain, exists := FromContext(r.Context()); exists {
+		chain.annotateTrace(co.name + "→coalesced")
+		if call.err != nil {
+			chain.SetError(call.err)
+		}
+	}
+}
+
+// coalesceWriter writes the response of a coalesced call and captures it.
+type coalesceWriter struct {
+	http.ResponseWriter
+	call  *coalescedCall
+	limit int
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (cw *coalesceWriter) WriteHeader(status int) {
+	if cw.call.status == 0 {
+		cw.call.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.Write.
+func (cw *coalesceWriter) Write(b []byte) (int, error) {
+	if cw.call.status == 0 {
+		cw.call.status = http.StatusOK
+	}
+	if !cw.call.bypass {
+		if cw.call.body.Len()+len(b) > cw.limit {
+			cw.call.bypass = true
+			cw.call.body.Reset()
+		} else {
+			cw.call.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.Flush if the underlying writer supports it.
+func (cw *coalesceWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
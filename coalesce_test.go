@@ -0,0 +1,169 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Coalesce behaviours tested by runCoalesced.
+const (
+	coalesceOK = iota
+	coalesceFail
+	coalescePanic
+)
+
+func runCoalesced(t *testing.T, n, limit int, body string, mode int) (calls int32, recs []*httptest.ResponseRecorder, chains []*Chain) {
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if mode == coalescePanic {
+			panic("expensive panic")
+		}
+		w.Header().Set("X-Expensive", "yes")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=leader")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(body))
+		if mode == coalesceFail {
+			chain, _ := Unpack(r, testkey)
+			chain.SetError(errors.New("expensive failure"))
+		}
+	})
+	keyFn := func(r *http.Request) string { return r.URL.Path }
+	co := Coalesce("expensive", keyFn, h, CoalesceOptions{
+		Limit:   limit,
+		Headers: []string{"Content-Type", "x-expensive"},
+	})
+	template := New(testkey, WithRecoveryFunc(func(recovered interface{}) error {
+		return errors.New("recovered")
+	}))
+	template.Append("coalesce", co)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		chains = append(chains, template.Clone())
+		recs = append(recs, httptest.NewRecorder())
+		wg.Add(1)
+		go func(chain *Chain, rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			chain.ServeHTTP(rec, MakeRequest("/expensive"))
+		}(chains[i], recs[i])
+	}
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1 && atomic.LoadInt64(&co.(*coalescer).joined) == int64(n-1)
+	})
+	close(release)
+	wg.Wait()
+	return
+}
+
+func TestCoalesce(t *testing.T) {
+
+	const n = 8
+
+	calls, recs, chains := runCoalesced(t, n, 0, "expensive response", coalesceOK)
+	if calls != 1 {
+		t.Fatalf("Coalesce() executed handler %d times", calls)
+	}
+	leaders := 0
+	for i, rec := range recs {
+		if rec.Code != http.StatusAccepted || rec.Header().Get("X-Expensive") != "yes" || rec.Body.String() != "expensive response" {
+			t.Fatal("Coalesce() failed to replay response")
+		}
+		if rec.Header().Get("Content-Type") != "text/plain" {
+			t.Fatal("Coalesce() failed to replay headers")
+		}
+		if cookie := rec.Header().Get("Set-Cookie"); cookie != "" {
+			leaders++
+		}
+		if chains[i].LastError() != nil {
+			t.Fatal("Coalesce() set error")
+		}
+	}
+	if leaders != 1 {
+		t.Fatal("Coalesce() replayed request specific headers")
+	}
+}
+
+func TestCoalesceError(t *testing.T) {
+
+	_, _, chains := runCoalesced(t, 4, 0, "failed", coalesceFail)
+	for _, chain := range chains {
+		if err := chain.LastError(); err == nil || err.Error() != "expensive failure" {
+			t.Fatal("Coalesce() failed to propagate error")
+		}
+	}
+}
+
+func TestCoalesceLimit(t *testing.T) {
+
+	body := strings.Repeat("x", 100)
+	calls, recs, _ := runCoalesced(t, 4, 10, body, coalesceOK)
+	if calls != 4 {
+		t.Fatalf("Coalesce() executed handler %d times", calls)
+	}
+	for _, rec := range recs {
+		if rec.Body.String() != body {
+			t.Fatal("Coalesce() failed to bypass")
+		}
+	}
+}
+
+func TestCoalescePanic(t *testing.T) {
+
+	calls, recs, chains := runCoalesced(t, 4, 0, "", coalescePanic)
+	if calls != 1 {
+		t.Fatalf("Coalesce() executed handler %d times", calls)
+	}
+	waiters := 0
+	for i, rec := range recs {
+		err := chains[i].LastError()
+		if errors.Is(err, ErrCoalescedPanic) {
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatal("Coalesce() failed to set status")
+			}
+			waiters++
+		} else if err == nil || err.Error() != "recovered" {
+			t.Fatal("Coalesce() failed to propagate panic")
+		}
+	}
+	if waiters != 3 {
+		t.Fatal("Coalesce() failed to release waiters")
+	}
+
+	// The key is released and the next request executes the handler.
+	c := New(testkey)
+	served := false
+	co := Coalesce("after", func(r *http.Request) string { return "key" }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !served {
+			served = true
+			panic("once")
+		}
+	}), CoalesceOptions{})
+	c.Append("coalesce", co)
+	func() {
+		defer func() { recover() }()
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}()
+	done := make(chan struct{})
+	go func() {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Coalesce() failed to release key")
+	}
+}
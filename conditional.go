@@ -0,0 +1,181 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// DefaultConditionalLimit is the response size limit used by Conditional
+// if a limit less than 1 is specified.
+const DefaultConditionalLimit = 1 << 20
+
+// Conditional returns a handler named name that buffers the response
+// written by handlers that follow it in the chain, computes its ETag using
+// etagFn and responds with 304 Not Modified and no body if the ETag
+// matches the If-None-Match request header or with the ETag header and
+// the buffered response otherwise. If etagFn is nil, a strong ETag derived
+// from the SHA-256 hash of the response body is used. An empty ETag
+// leaves the response unchanged.
+//
+// Only GET and HEAD requests with 200 OK responses are handled. Responses
+// of other status codes, flushed responses and responses larger than
+// limit bytes are streamed unchanged. A limit less than 1 selects
+// DefaultConditionalLimit.
+//
+// The ETag is computed on bytes as written by following handlers, i.e.
+// before any encoding applied by handlers or wrappers preceding it.
+// The trace entry of the handler is annotated as "name→not modified" if
+// 304 Not Modified was written and as "name→modified" if the ETag header
+// was written with the response. Conditional does nothing if executed
+// outside of a chain.
+func Conditional(name string, etagFn func(*http.Request, []byte) string, limit int) http.Handler {
+	if etagFn == nil {
+		etagFn = hashETag
+	}
+	if limit < 1 {
+		limit = DefaultConditionalLimit
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return
+		}
+		chain, exists := FromContext(r.Context())
+		if !exists {
+			return
+		}
+		cw := &conditionalWriter{
+			r:      r,
+			etagFn: etagFn,
+			limit:  limit,
+			name:   name,
+			chain:  chain,
+			entry:  chain.traceEntry(),
+		}
+		chain.wrapWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			cw.ResponseWriter = w
+			return cw
+		}, cw.done)
+	})
+}
+
+// hashETag returns a strong ETag of body.
+func hashETag(r *http.Request, body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch returns true if etag matches the If-None-Match header value
+// using weak comparison.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalWriter buffers a response for Conditional.
+type conditionalWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	etagFn  func(*http.Request, []byte) string
+	limit   int
+	name    string
+	chain   *Chain
+	entry   int
+	status  int
+	buf     bytes.Buffer
+	passing bool
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (cw *conditionalWriter) WriteHeader(status int) {
+	if cw.passing {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if status != http.StatusOK {
+		cw.pass()
+	}
+}
+
+// Write implements http.ResponseWriter.Write.
+func (cw *conditionalWriter) Write(b []byte) (int, error) {
+	if cw.passing {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.buf.Len()+len(b) > cw.limit {
+		if err := cw.pass(); err != nil {
+			return 0, err
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.buf.Write(b)
+}
+
+// Flush implements http.Flusher.Flush by switching to streaming.
+func (cw *conditionalWriter) Flush() {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.pass()
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// pass writes the buffered response and switches to streaming.
+func (cw *conditionalWriter) pass() error {
+	if cw.passing {
+		return nil
+	}
+	cw.passing = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// done completes the response.
+func (cw *conditionalWriter) done() {
+	if cw.passing || cw.status == 0 {
+		return
+	}
+	etag := cw.etagFn(cw.r, cw.buf.Bytes())
+	if etag == "" {
+		cw.pass()
+		return
+	}
+	cw.Header().Set("ETag", etag)
+	if etagMatch(cw.r.Header.Get("If-None-Match"), etag) {
+		header := cw.Header()
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		cw.passing = true
+		cw.ResponseWriter.WriteHeader(http.StatusNotModified)
+		cw.chain.annotateTraceAt(cw.entry, cw.name+"→not modified")
+		return
+	}
+	cw.pass()
+	cw.chain.annotateTraceAt(cw.entry, cw.name+"→modified")
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func makeConditionalChain(limit int, body string) *Chain {
+	c := New(testkey)
+	c.Append("conditional", Conditional("etag", nil, limit))
+	c.Append("content", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body[:len(body)/2]))
+		w.Write([]byte(body[len(body)/2:]))
+	}))
+	return c
+}
+
+func serveConditional(c *Chain, method, inm string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/", nil)
+	if inm != "" {
+		req.Header.Set("If-None-Match", inm)
+	}
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConditional(t *testing.T) {
+
+	const body = "conditional response body"
+
+	c := makeConditionalChain(0, body)
+
+	rec := serveConditional(c, "GET", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.String() != body {
+		t.Fatal("Conditional() failed")
+	}
+
+	if trace := strings.Join(c.LastRun().Trace, ","); trace != "etag→modified,content" {
+		t.Fatalf("Conditional() failed to annotate trace: %s", trace)
+	}
+
+	rec = serveConditional(c, "GET", `"other", `+etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Fatal("Conditional() failed to match")
+	}
+	if trace := strings.Join(c.LastRun().Trace, ","); trace != "etag→not modified,content" {
+		t.Fatalf("Conditional() failed to annotate trace: %s", trace)
+	}
+
+	rec = serveConditional(c, "GET", `"mismatch"`)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag || rec.Body.String() != body {
+		t.Fatal("Conditional() failed on mismatch")
+	}
+
+	rec = serveConditional(c, "HEAD", "W/"+etag)
+	if rec.Code != http.StatusNotModified {
+		t.Fatal("Conditional() failed on HEAD")
+	}
+
+	rec = serveConditional(c, "POST", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" || rec.Body.String() != body {
+		t.Fatal("Conditional() failed to skip POST")
+	}
+}
+
+func TestConditionalLimit(t *testing.T) {
+
+	body := strings.Repeat("x", 100)
+	c := makeConditionalChain(60, body)
+	rec := serveConditional(c, "GET", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" || rec.Body.String() != body {
+		t.Fatal("Conditional() failed to fall back to streaming")
+	}
+}
+
+func TestConditionalStatus(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("conditional", Conditional("etag", nil, 0))
+	c.Append("notfound", http.NotFoundHandler())
+	rec := serveConditional(c, "GET", "*")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Fatal("Conditional() failed to skip non-200 response")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrHeaderDeadline is set as the chain error when no response header was
+// written within the deadline set by WithHeaderDeadline.
+var ErrHeaderDeadline = ErrChainer.Wrap("response header deadline exceeded")
+
+// ErrDeadlineExceeded is set as the chain error when a chain served by
+// ServeWithDeadline passes the deadline.
+var ErrDeadlineExceeded = ErrChainer.Wrap("deadline exceeded")
+
+// ServeWithDeadline serves the request like ServeHTTP but with a request
+// context that carries deadline, so that context aware handlers stop once
+// it passes, and stops executing handlers with ErrDeadlineExceeded if the
+// deadline passed, as reported by the chain clock, before executing the
+// next handler. Post-run handlers are executed as usual.
+func (c *Chain) ServeWithDeadline(deadline time.Time, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	defer cancel()
+	c.serve(nil, deadline, w, r.WithContext(ctx))
+}
+
+// WithHeaderDeadline makes the chain stop a run whose handlers did not
+// write the response header, explicitly or by writing the body, within d
+// of the run start.
+//
+// On expiry ErrHeaderDeadline is set as the chain error, the error
+// response is written by the error handler set by SetErrorHandler or as a
+// plain 503 Service Unavailable if none is set, and all subsequent writes
+// of the still running handler are discarded. The run stops once that
+// handler returns. Runs that wrote the header in time, such as streaming
+// handlers that keep writing the body afterwards, are not affected. The
+// deadline applies to the chain handlers only, once they finish the
+// result is dispatched to the error handler and post-run handlers without
+// a deadline.
+//
+// Expiry is detected by a timer and, at the time of a write, by the chain
+// clock set by WithClock, so that it can be tested with a fake clock.
+func WithHeaderDeadline(d time.Duration) Option {
+	return func(c *Chain) { c.hdrdeadline = d }
+}
+
+// deadlineWriter states.
+const (
+	deadlinePending = iota
+	deadlineWritten
+	deadlineExpired
+)
+
+// deadlineWriter is a http.ResponseWriter that enforces a header deadline.
+type deadlineWriter struct {
+	http.ResponseWriter
+	chain    *Chain
+	request  *http.Request
+	deadline time.Time
+	timer    *time.Timer
+
+	mu    sync.Mutex
+	state int
+}
+
+// newDeadlineWriter returns a new deadlineWriter writing to w for r.
+func (c *Chain) newDeadlineWriter(w http.ResponseWriter, r *http.Request) *deadlineWriter {
+	dw := &deadlineWriter{
+		ResponseWriter: w,
+		chain:          c,
+		request:        r,
+		deadline:       c.now().Add(c.hdrdeadline),
+	}
+	dw.timer = time.AfterFunc(c.hdrdeadline, func() {
+		dw.mu.Lock()
+		defer dw.mu.Unlock()
+		if dw.state == deadlinePending {
+			dw.expire()
+		}
+	})
+	return dw
+}
+
+// stop stops the deadline timer.
+func (dw *deadlineWriter) stop() { dw.timer.Stop() }
+
+// settle stops the deadline timer once the run stops executing handlers
+// so that it cannot expire while the result is dispatched. A pending
+// deadline is expired if it passed or considered met otherwise.
+func (dw *deadlineWriter) settle() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.timer.Stop()
+	dw.pass()
+}
+
+// pass returns true if a write may pass through to the underlying writer
+// and expires the deadline if it passed. mu must be locked by the caller.
+func (dw *deadlineWriter) pass() bool {
+	if dw.state == deadlinePending {
+		if dw.chain.now().Before(dw.deadline) {
+			dw.state = deadlineWritten
+		} else {
+			dw.expire()
+		}
+	}
+	return dw.state == deadlineWritten
+}
+
+// expire sets ErrHeaderDeadline and writes the error response.
+// mu must be locked by the caller.
+func (dw *deadlineWriter) expire() {
+	dw.state = deadlineExpired
+	dw.chain.SetError(ErrHeaderDeadline)
+	if errorfunc := dw.chain.errorfunc; errorfunc != nil {
+		errorfunc(dw.ResponseWriter, dw.request, ErrHeaderDeadline)
+		return
+	}
+	http.Error(dw.ResponseWriter, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (dw *deadlineWriter) WriteHeader(status int) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.pass() {
+		dw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write implements http.ResponseWriter.Write.
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if !dw.pass() {
+		return len(b), nil
+	}
+	return dw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.Flush if the underlying writer supports it.
+func (dw *deadlineWriter) Flush() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if flusher, ok := dw.ResponseWriter.(http.Flusher); ok && dw.pass() {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.Hijack if the underlying writer
+// supports it.
+func (dw *deadlineWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := dw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errNotHijacker
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter { return dw.ResponseWriter }
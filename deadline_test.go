@@ -0,0 +1,128 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHeaderDeadline(t *testing.T) {
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	writer := func(before, between time.Duration) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.Advance(before)
+			w.WriteHeader(http.StatusAccepted)
+			clock.Advance(between)
+			fmt.Fprint(w, "body")
+		})
+	}
+	serve := func(h http.Handler) (*Chain, *httptest.ResponseRecorder) {
+		c := New(testkey, WithClock(clock.Now), WithHeaderDeadline(time.Minute))
+		c.Append("writer", h)
+		c.Append("after", MakeHandler("after"))
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, MakeRequest("/"))
+		return c, rec
+	}
+
+	// On time.
+	c, rec := serve(writer(30*time.Second, 0))
+	if c.LastError() != nil || rec.Code != http.StatusAccepted || rec.Body.String() != "bodyHandler 'after' reporting in.\n" {
+		t.Fatal("WithHeaderDeadline() failed on time")
+	}
+
+	// Late.
+	c, rec = serve(writer(2*time.Minute, 0))
+	if !errors.Is(c.LastError(), ErrHeaderDeadline) || rec.Code != http.StatusServiceUnavailable ||
+		rec.Body.String() != "Service Unavailable\n" {
+		t.Fatal("WithHeaderDeadline() failed late")
+	}
+
+	// Already writing.
+	c, rec = serve(writer(0, 2*time.Minute))
+	if c.LastError() != nil || rec.Code != http.StatusAccepted || rec.Body.String() != "bodyHandler 'after' reporting in.\n" {
+		t.Fatal("WithHeaderDeadline() failed already writing")
+	}
+}
+
+func TestHeaderDeadlineTimer(t *testing.T) {
+
+	c := New(testkey, WithHeaderDeadline(10*time.Millisecond))
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	})
+	c.Append("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "too late")
+	}))
+	c.Append("after", MakeHandler("after"))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if !errors.Is(c.LastError(), ErrHeaderDeadline) || rec.Code != http.StatusGatewayTimeout ||
+		rec.Body.String() != ErrHeaderDeadline.Error()+"\n" {
+		t.Fatal("WithHeaderDeadline() failed")
+	}
+}
+
+func TestHeaderDeadlineDeferred(t *testing.T) {
+
+	c := New(testkey, WithHeaderDeadline(10*time.Millisecond))
+	c.Append("silent", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	c.DeferHandler("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("X-Deferred", "yes")
+		fmt.Fprint(w, "deferred")
+	}))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if c.LastError() != nil || rec.Code != http.StatusOK || rec.Body.String() != "deferred" {
+		t.Fatal("WithHeaderDeadline() expired during post-run handlers")
+	}
+}
+
+func TestServeWithDeadline(t *testing.T) {
+
+	var cancelled bool
+	slow := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(30 * time.Millisecond):
+				fmt.Fprintf(w, "%s;", name)
+			case <-r.Context().Done():
+				cancelled = true
+			}
+		})
+	}
+	c := New(testkey)
+	c.Append("h1", slow("h1"))
+	c.Append("h2", slow("h2"))
+	c.Append("h3", slow("h3"))
+	c.Append("h4", MakeHandler("h4"))
+
+	rec := httptest.NewRecorder()
+	c.ServeWithDeadline(time.Now().Add(50*time.Millisecond), rec, MakeRequest("/"))
+	if !errors.Is(c.LastError(), ErrDeadlineExceeded) || !cancelled || rec.Body.String() != "h1;" {
+		t.Fatalf("ServeWithDeadline() failed: %v %s", c.LastError(), rec.Body.String())
+	}
+
+	// Deadline is tracked by the chain clock.
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c = New(testkey, WithClock(clock.Now))
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(time.Minute)
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	rec = httptest.NewRecorder()
+	c.ServeWithDeadline(time.Unix(30, 0), rec, MakeRequest("/"))
+	if !errors.Is(c.LastError(), ErrDeadlineExceeded) || rec.Body.Len() != 0 {
+		t.Fatal("ServeWithDeadline() failed")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+)
+
+// ErrMaxDepth is set as the chain error when a chain is executed nested
+// deeper than the maximum depth set by WithMaxDepth.
+var ErrMaxDepth = ErrChainer.WrapFormat("maximum nesting depth %d exceeded")
+
+// WithMaxDepth limits the depth of chain nesting to n. A chain executed
+// at a depth greater than n, with the chain having the option at depth 1,
+// executes no handlers and sets ErrMaxDepth sibling as its error which
+// propagates to parent chains. The limit applies to all chains nested in
+// the chain, the smallest limit in effect wins. A value less than 1 means
+// no limit.
+//
+// A chain executed recursively while a limit is in effect, i.e. nested in
+// itself directly or through other chains or served again by one of its
+// handlers with the request it is serving, is not served again as it is
+// already serving the request. The recursive run executes no handlers and
+// sets ErrMaxDepth sibling as the error of the run it recursed from.
+func WithMaxDepth(n int) Option {
+	return func(c *Chain) { c.maxdepth = n }
+}
+
+// depthKey is the context key for the chain nesting depth.
+type depthKey struct{}
+
+// activeKey is the context key marking a chain as serving a request.
+type activeKey struct{ c *Chain }
+
+// depthInfo is the chain nesting depth and the limit in effect.
+type depthInfo struct {
+	depth int
+	limit int
+}
+
+// withDepth returns ctx carrying the nesting depth of c and an error if
+// the depth exceeds the limit in effect.
+func (c *Chain) withDepth(ctx context.Context) (context.Context, error) {
+	info, _ := ctx.Value(depthKey{}).(depthInfo)
+	info.depth++
+	if c.maxdepth > 0 && (info.limit == 0 || info.depth-1+c.maxdepth < info.limit) {
+		info.limit = info.depth - 1 + c.maxdepth
+	}
+	ctx = context.WithValue(ctx, depthKey{}, info)
+	if info.limit > 0 {
+		ctx = context.WithValue(ctx, activeKey{c}, true)
+	}
+	if info.limit > 0 && info.depth > info.limit {
+		return ctx, ErrMaxDepth.WrapArgs(info.limit)
+	}
+	return ctx, nil
+}
+
+// recursion returns ErrMaxDepth sibling if ctx is the context of a request
+// c is already serving with a depth limit in effect or nil otherwise.
+func (c *Chain) recursion(ctx context.Context) error {
+	if ctx.Value(activeKey{c}) == nil {
+		return nil
+	}
+	info, _ := ctx.Value(depthKey{}).(depthInfo)
+	return ErrMaxDepth.WrapArgs(info.limit)
+}
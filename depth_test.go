@@ -0,0 +1,104 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxDepth(t *testing.T) {
+
+	executed := 0
+	build := func(depth int, options ...Option) *Chain {
+		var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			executed++
+		})
+		var c *Chain
+		for i := 0; i < depth; i++ {
+			if i == depth-1 {
+				c = New(testkey, options...)
+			} else {
+				c = New(testkey)
+			}
+			c.Append("nested", handler)
+			handler = c
+		}
+		return c
+	}
+
+	c := build(4, WithMaxDepth(3))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if !errors.Is(c.LastError(), ErrMaxDepth) || executed != 0 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+
+	c = build(3, WithMaxDepth(3))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastError() != nil || executed != 1 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+
+	// Smaller limit of a nested chain wins.
+	inner := build(3, WithMaxDepth(2))
+	outer := New(testkey, WithMaxDepth(10))
+	outer.Append("inner", inner)
+	outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if !errors.Is(outer.LastError(), ErrMaxDepth) || executed != 1 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+}
+
+func TestMaxDepthRecursion(t *testing.T) {
+
+	serve := func(c *Chain) {
+		done := make(chan struct{})
+		go func() {
+			c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("WithMaxDepth() failed, recursive chain deadlocked")
+		}
+	}
+
+	executed := 0
+	counter := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { executed++ })
+
+	// Chain nested in itself.
+	c := New(testkey, WithMaxDepth(3))
+	c.Append("count", counter)
+	c.Append("self", c)
+	serve(c)
+	if !errors.Is(c.LastError(), ErrMaxDepth) || executed != 1 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+
+	// Chains nested in each other.
+	a, b := New(testkey, WithMaxDepth(3)), New(testkey)
+	a.Append("count", counter)
+	a.Append("b", b)
+	b.Append("a", a)
+	serve(a)
+	if !errors.Is(a.LastError(), ErrMaxDepth) || executed != 2 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+
+	// Handler serving its chain again.
+	c = New(testkey, WithMaxDepth(3))
+	c.Append("recurse", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed++
+		c.ServeHTTP(w, r)
+	}))
+	serve(c)
+	if !errors.Is(c.LastError(), ErrMaxDepth) || executed != 3 {
+		t.Fatal("WithMaxDepth() failed")
+	}
+}
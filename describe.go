@@ -0,0 +1,184 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// ChainDescription is a snapshot of a chain configuration, structure and
+// counters returned by Describe.
+type ChainDescription struct {
+	// KeyType is the type of the key the chain is unpacked with.
+	KeyType string `json:"keytype"`
+	// Options are the chain options.
+	Options ChainOptions `json:"options"`
+	// Handlers are descriptions of handlers in the chain in execution
+	// order.
+	Handlers []HandlerDescription `json:"handlers"`
+	// Entries are handler names keyed by entry point paths.
+	Entries map[string]string `json:"entries,omitempty"`
+	// Requests is the number of requests the chain served.
+	Requests uint64 `json:"requests"`
+	// Failures is the number of requests that ended with an error.
+	Failures uint64 `json:"failures"`
+	// InFlight is the number of requests currently being served
+	// or waiting to be served by the chain.
+	InFlight int `json:"inflight"`
+	// TeeErrors is the number of failed writes to response tee sinks.
+	TeeErrors uint64 `json:"teeerrors"`
+	// LateWrites is the number of detected late writes.
+	LateWrites uint64 `json:"latewrites"`
+	// DroppedErrorReports is the number of error reports dropped by the
+	// error sink.
+	DroppedErrorReports uint64 `json:"droppederrorreports"`
+}
+
+// ChainOptions are chain options as set by Option functions.
+type ChainOptions struct {
+	// MaxVars is the maximum number of variables, see WithMaxVarSize.
+	MaxVars int `json:"maxvars"`
+	// MaxDepth is the maximum nesting depth, see WithMaxDepth.
+	MaxDepth int `json:"maxdepth"`
+	// TraceLimit is the trace limit, see WithTraceLimit.
+	TraceLimit int `json:"tracelimit"`
+	// DrainBody is true if WithDrainBody was specified.
+	DrainBody bool `json:"drainbody"`
+	// CancelOnError is true if WithCancelOnError was specified.
+	CancelOnError bool `json:"cancelonerror"`
+	// StrictBarriers is true if WithStrictBarriers was specified.
+	StrictBarriers bool `json:"strictbarriers"`
+	// Counters is true if WithCounters was specified.
+	Counters bool `json:"counters"`
+	// HeaderDeadline is the header deadline, see WithHeaderDeadline.
+	HeaderDeadline time.Duration `json:"headerdeadline"`
+	// LateWrite is the late write reaction, see WithLateWrite.
+	LateWrite LateWriteReaction `json:"latewrite"`
+	// StreamTrailer is the stream error trailer, see WithStreamError.
+	StreamTrailer string `json:"streamtrailer,omitempty"`
+}
+
+// HandlerDescription describes a handler in a chain.
+type HandlerDescription struct {
+	// Name is the name of the handler as registered.
+	Name string `json:"name"`
+	// Type is the type of the handler.
+	Type string `json:"type"`
+	// Method is the method restriction set by AppendMethod, if any.
+	Method string `json:"method,omitempty"`
+	// Terminal is true if the handler was marked with MarkTerminal.
+	Terminal bool `json:"terminal,omitempty"`
+	// Barrier is true if the handler was marked with MarkBarrier.
+	Barrier bool `json:"barrier,omitempty"`
+	// Disabled is true if the handler is disabled.
+	Disabled bool `json:"disabled,omitempty"`
+	// Prefix is the path prefix if the handler was appended with
+	// AppendPrefix.
+	Prefix string `json:"prefix,omitempty"`
+	// Chain is the description of the nested chain if the handler is
+	// a chain or was appended with AppendPrefix or GroupWith.
+	Chain *ChainDescription `json:"chain,omitempty"`
+	// Cycle is true if the handler is a chain nested in itself, directly
+	// or through other chains, in which case Chain is nil.
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// Describe returns a ChainDescription of the chain and its nested chains.
+// Describe shares the lock with ServeHTTP.
+func (c *Chain) Describe() ChainDescription {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	return c.describe(map[*Chain]bool{c: true})
+}
+
+// describe returns a ChainDescription of c. active are chains being
+// described, c and its ancestors, whose runmu is locked.
+// runmu must be locked by the caller.
+func (c *Chain) describe(active map[*Chain]bool) ChainDescription {
+	desc := ChainDescription{
+		KeyType: fmt.Sprintf("%T", c.key),
+		Options: ChainOptions{
+			MaxVars:        c.maxvars,
+			MaxDepth:       c.maxdepth,
+			TraceLimit:     c.tracelimit,
+			DrainBody:      c.drainbody,
+			CancelOnError:  c.cancelerr,
+			StrictBarriers: c.strictbar,
+			Counters:       c.counting,
+			HeaderDeadline: c.hdrdeadline,
+			LateWrite:      c.latewrite,
+			StreamTrailer:  c.streamtrailer,
+		},
+		Requests:   atomic.LoadUint64(&c.requests),
+		Failures:   atomic.LoadUint64(&c.failures),
+		InFlight:   int(atomic.LoadInt32(&c.inflight)),
+		TeeErrors:  atomic.LoadUint64(&c.teeerrs),
+		LateWrites: atomic.LoadUint64(&c.latewrs),
+
+		DroppedErrorReports: atomic.LoadUint64(&c.sinkdrop),
+	}
+
+	c.varmu.Lock()
+	desc.Handlers = make([]HandlerDescription, 0, len(c.links))
+	for i, link := range c.links {
+		if i >= len(c.indexes) {
+			break
+		}
+		key := c.indexes[i]
+		desc.Handlers = append(desc.Handlers, HandlerDescription{
+			Name:     c.spells[key],
+			Type:     handlerType(link),
+			Method:   c.methods[key],
+			Terminal: c.marks[key],
+			Barrier:  c.barriers[key],
+			Disabled: c.disabled[key],
+		})
+	}
+	if len(c.entries) > 0 {
+		desc.Entries = make(map[string]string, len(c.entries))
+		for path, key := range c.entries {
+			desc.Entries[path] = c.spells[key]
+		}
+	}
+	c.varmu.Unlock()
+
+	for i := range desc.Handlers {
+		var nested *Chain
+		switch handler := c.links[i].(type) {
+		case *Chain:
+			nested = handler
+		case *prefixHandler:
+			desc.Handlers[i].Prefix = handler.prefix
+			nested = handler.chain
+		default:
+			continue
+		}
+		if active[nested] {
+			desc.Handlers[i].Cycle = true
+			continue
+		}
+		nested.runmu.Lock()
+		active[nested] = true
+		sub := nested.describe(active)
+		delete(active, nested)
+		nested.runmu.Unlock()
+		desc.Handlers[i].Chain = &sub
+	}
+	return desc
+}
+
+// handlerType returns the name of the dynamic type of h or "<nil>" if h
+// is nil.
+func handlerType(h http.Handler) string {
+	if h == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(h).String()
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+
+	sub := New(testkey)
+	sub.Append("s1", MakeHandler("s1"))
+
+	c := New(testkey, WithMaxVarSize(8), WithDrainBody(), WithCounters())
+	c.Append("h1", MakeHandler("h1"))
+	c.AppendMethod("GET", "h2", newTestHandler("h2"))
+	c.AppendPrefix("/api", sub)
+	c.MarkTerminal("h2")
+	c.Disable("h1")
+	c.SetEntryPoint("/start", "h2")
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+
+	desc := c.Describe()
+	if desc.KeyType != "string" || desc.Options.MaxVars != 8 || !desc.Options.DrainBody ||
+		!desc.Options.Counters || desc.Options.TraceLimit != DefaultTraceLimit {
+		t.Fatal("Describe() failed")
+	}
+	if desc.Requests != 1 || desc.Failures != 0 || desc.Entries["/start"] != "h2" {
+		t.Fatal("Describe() failed")
+	}
+	if len(desc.Handlers) != 3 {
+		t.Fatal("Describe() failed")
+	}
+	h1, h2, api := desc.Handlers[0], desc.Handlers[1], desc.Handlers[2]
+	if h1.Name != "h1" || h1.Type != "http.HandlerFunc" || !h1.Disabled {
+		t.Fatal("Describe() failed")
+	}
+	if h2.Name != "h2" || h2.Type != "*chainer.TestHandler" || h2.Method != "GET" || !h2.Terminal {
+		t.Fatal("Describe() failed")
+	}
+	if api.Prefix != "/api" || api.Chain == nil || len(api.Chain.Handlers) != 1 || api.Chain.Handlers[0].Name != "s1" {
+		t.Fatal("Describe() failed")
+	}
+	if _, err := json.Marshal(desc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDescribeCycle(t *testing.T) {
+
+	self, mutual := cyclicChains()
+	var selfDesc, mutualDesc ChainDescription
+	within(t, func() {
+		selfDesc = self.Describe()
+		mutualDesc = mutual.Describe()
+	})
+	if h := selfDesc.Handlers[1]; !h.Cycle || h.Chain != nil {
+		t.Fatal("Describe() failed to report cycle")
+	}
+	if h := mutualDesc.Handlers[0].Chain.Handlers[0]; !h.Cycle || h.Chain != nil {
+		t.Fatal("Describe() failed to report cycle")
+	}
+}
+
+func TestDescribeNilHandler(t *testing.T) {
+
+	c := New(testkey)
+	if err := c.Append("nil", nil); err != nil {
+		t.Fatal(err)
+	}
+	if desc := c.Describe(); desc.Handlers[0].Type != "<nil>" {
+		t.Fatal("Describe() failed")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"io"
+	"net/http"
+)
+
+// DeferHandler registers a handler under a specified name to be executed
+// after every ServeHTTP call regardless of its outcome.
+// Name must be unique among deferred handlers or ErrDupName sibling is
+// returned. Deferred handlers are executed in order as they were
+// registered.
+//
+// Once the handler loop finishes ServeHTTP dispatches the result to
+// post-run handlers in the following order:
+//
+//  1. Request context cancellation if WithCancelOnError was specified and
+//     LastError is not nil.
+//  2. Empty handler set by SetOnEmpty, if no chain handler was executed
+//     and the response was not yet written.
+//  3. Error handler set by SetErrorHandler, or the status code resolved
+//     by error mappings registered with MapError if no error handler was
+//     set, if LastError is not nil and the response was not yet written.
+//  4. Stream error reporting set by WithStreamError, if LastError is not
+//     nil and the response was already written by a chain handler.
+//  5. Handlers registered with OnSuccess if LastError is nil or handlers
+//     registered with OnFailure if LastError is not nil.
+//  6. Handlers registered with DeferHandler.
+//  7. Internal run observers, such as CircuitBreaker.
+//  8. Request body draining if WithDrainBody was specified.
+//  9. Error report queuing if SetErrorSink was set and LastError is not
+//     nil.
+//
+// Errors set by post-run handlers are recorded but do not change which
+// post-run handlers are executed.
+func (c *Chain) DeferHandler(name string, handler http.Handler) (err error) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.deferred, err = appendNamed(c.deferred, name, handler)
+	return
+}
+
+// Finally registers a handler under a specified name to be executed after
+// every ServeHTTP call regardless of its outcome. It is an alias for
+// DeferHandler; handlers registered by either share the same namespace
+// and are executed in order as they were registered.
+func (c *Chain) Finally(name string, handler http.Handler) error {
+	return c.DeferHandler(name, handler)
+}
+
+// SetErrorHandler sets a function that writes the response for a request
+// that finished with an error. It is called only if no handler in the
+// chain has written the response header or body yet so that the response
+// is written by a single writer. A nil fn removes the error handler.
+func (c *Chain) SetErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.errorfunc = fn
+}
+
+// SetResponseWrapper sets a function that wraps the http.ResponseWriter
+// passed to chain handlers during ServeHTTP, for instance to buffer,
+// compress or capture the response. If the returned writer implements
+// io.Closer it is closed after the last chain handler returns and before
+// post-run handlers, which write to the unwrapped writer, are executed.
+//
+// The wrapper should implement http.Flusher and http.Hijacker if the
+// wrapped writer does or provide an Unwrap method returning the wrapped
+// writer so that http.ResponseController can reach them.
+// A nil fn removes the wrapper.
+func (c *Chain) SetResponseWrapper(fn func(http.ResponseWriter) http.ResponseWriter) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.wrapfunc = fn
+}
+
+// SetOnEmpty sets a function that writes the response for a request
+// during which no chain handler was executed, for instance because the
+// chain is empty or no handler matched the request method, and no
+// response was written. A nil fn removes the function.
+func (c *Chain) SetOnEmpty(fn func(w http.ResponseWriter, r *http.Request)) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.emptyfunc = fn
+}
+
+// written returns true if w is a recorder that recorded a write.
+func written(w http.ResponseWriter) bool {
+	rec, ok := w.(interface{ Written() bool })
+	return ok && rec.Written()
+}
+
+// finish dispatches the result of a run to post-run handlers in the
+// order documented on DeferHandler. w must be a *recorder.
+func (c *Chain) finish(w http.ResponseWriter, r *http.Request) {
+	if rec, ok := w.(*recorder); ok {
+		w = dispatchWriter{rec}
+	}
+	err := c.LastError()
+	if err != nil && c.cancelrun != nil {
+		c.cancelrun(err)
+	}
+	if c.executed == 0 && c.emptyfunc != nil && !written(w) {
+		c.emptyfunc(w, r)
+	}
+	status := 0
+	if err != nil {
+		status = c.resolveStatus(err)
+	}
+	if err != nil && !written(w) {
+		if c.errorfunc != nil {
+			c.varmu.Lock()
+			c.handled = true
+			c.varmu.Unlock()
+			c.errorfunc(w, r, err)
+		} else if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+		}
+	} else if err != nil {
+		c.streamError(w, r, err)
+	}
+	finalizers := c.onsuccess
+	if err != nil {
+		finalizers = c.onfailure
+	}
+	for _, nh := range finalizers {
+		nh.handler.ServeHTTP(w, r)
+	}
+	for _, nh := range c.deferred {
+		nh.handler.ServeHTTP(w, r)
+	}
+	c.varmu.Lock()
+	afterrun := c.afterrun
+	c.afterrun = nil
+	c.varmu.Unlock()
+	for _, fn := range afterrun {
+		fn(err)
+	}
+	if c.drainbody && r.Body != nil {
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+	}
+}
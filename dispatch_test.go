@@ -0,0 +1,249 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchOrder(t *testing.T) {
+
+	const (
+		featErrorHandler = 1 << iota
+		featOnSuccess
+		featOnFailure
+		featDefer
+		featAll
+	)
+
+	type outcome struct {
+		name  string
+		write bool
+		fail  bool
+	}
+
+	outcomes := []outcome{
+		{"success", false, false},
+		{"error", false, true},
+		{"error after write", true, true},
+	}
+
+	for _, oc := range outcomes {
+		for features := 0; features < featAll; features++ {
+			var order []string
+			record := func(name string) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					order = append(order, name)
+				})
+			}
+
+			c := New(testkey)
+			c.Append("main", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, "main")
+				if oc.write {
+					w.Write([]byte("partial"))
+				}
+				if oc.fail {
+					chain, _ := Unpack(r, testkey)
+					chain.SetError(errors.New("main failed"))
+				}
+			}))
+			if features&featErrorHandler != 0 {
+				c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+					order = append(order, "error handler")
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				})
+			}
+			if features&featOnSuccess != 0 {
+				c.OnSuccess("success", record("success"))
+			}
+			if features&featOnFailure != 0 {
+				c.OnFailure("failure", record("failure"))
+			}
+			if features&featDefer != 0 {
+				c.DeferHandler("defer", record("defer"))
+			}
+
+			want := []string{"main"}
+			wantCode, wantBody := http.StatusOK, ""
+			if oc.write {
+				wantBody = "partial"
+			}
+			if oc.fail && !oc.write && features&featErrorHandler != 0 {
+				want = append(want, "error handler")
+				wantCode, wantBody = http.StatusInternalServerError, "main failed\n"
+			}
+			if !oc.fail && features&featOnSuccess != 0 {
+				want = append(want, "success")
+			}
+			if oc.fail && features&featOnFailure != 0 {
+				want = append(want, "failure")
+			}
+			if features&featDefer != 0 {
+				want = append(want, "defer")
+			}
+
+			rec := httptest.NewRecorder()
+			c.ServeHTTP(rec, MakeRequest("/"))
+			desc := fmt.Sprintf("%s with features %04b", oc.name, features)
+			if strings.Join(order, ",") != strings.Join(want, ",") {
+				t.Fatalf("%s: got order %v, want %v", desc, order, want)
+			}
+			if rec.Code != wantCode || rec.Body.String() != wantBody {
+				t.Fatalf("%s: got response %d %q, want %d %q", desc, rec.Code, rec.Body.String(), wantCode, wantBody)
+			}
+		}
+	}
+}
+
+func TestFinally(t *testing.T) {
+
+	var order []string
+	record := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, name)
+		})
+	}
+	c := New(testkey)
+	c.Append("h1", MakeHandlerThatSetsAnError("h1"))
+	c.DeferHandler("deferred", record("deferred"))
+	c.Finally("finally", record("finally"))
+	if err := c.Finally("deferred", record("deferred")); !errors.Is(err, ErrDupName) {
+		t.Fatal("Finally() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if strings.Join(order, ",") != "deferred,finally" {
+		t.Fatal("Finally() failed")
+	}
+}
+
+func TestCancelOnError(t *testing.T) {
+
+	cause := make(chan error, 1)
+	var deferredCause error
+	c := New(testkey, WithCancelOnError())
+	c.Append("spawner", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		go func() {
+			select {
+			case <-r.Context().Done():
+				cause <- context.Cause(r.Context())
+			case <-time.After(time.Second):
+				cause <- nil
+			}
+		}()
+	}))
+	c.Append("failer", MakeHandlerThatSetsAnError("failer"))
+	c.DeferHandler("defer", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deferredCause = context.Cause(r.Context())
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+
+	if err := <-cause; err == nil || err != c.LastError() {
+		t.Fatal("WithCancelOnError() failed to cancel context")
+	}
+	if deferredCause != c.LastError() {
+		t.Fatal("WithCancelOnError() failed to cancel before deferred handlers")
+	}
+
+	c = New(testkey, WithCancelOnError())
+	c.Append("checker", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deferredCause = r.Context().Err()
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if deferredCause != nil {
+		t.Fatal("WithCancelOnError() cancelled successful run")
+	}
+}
+
+func TestOnEmpty(t *testing.T) {
+
+	onEmpty := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nothing to do", http.StatusNotImplemented)
+	}
+
+	c := New(testkey)
+	c.SetOnEmpty(onEmpty)
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatal("SetOnEmpty() failed on empty chain")
+	}
+
+	c.AppendMethod("GET", "get", MakeHandler("get"))
+	c.AppendMethod("POST", "post", MakeHandler("post"))
+	c.SetEntryPoint("/post", "post")
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "Handler 'get' reporting in.\n" {
+		t.Fatal("SetOnEmpty() called for non-empty execution")
+	}
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/post"))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatal("SetOnEmpty() failed when all handlers were skipped")
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/", nil)
+	c.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatal("SetOnEmpty() overwrote response")
+	}
+}
+
+// countingWriter counts writes and flushes it passes to the wrapped writer.
+type countingWriter struct {
+	http.ResponseWriter
+	writes int
+	closed bool
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	cw.writes++
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *countingWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+func (cw *countingWriter) Close() error {
+	cw.closed = true
+	return nil
+}
+
+func TestSetResponseWrapper(t *testing.T) {
+
+	var cw *countingWriter
+	c := New(testkey)
+	c.SetResponseWrapper(func(w http.ResponseWriter) http.ResponseWriter {
+		cw = &countingWriter{ResponseWriter: w}
+		return cw
+	})
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("flush", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Fatal("wrapper does not preserve http.Flusher")
+		}
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	c.DeferHandler("deferred", MakeHandler("deferred"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if cw == nil || cw.writes != 2 || !cw.closed || !rec.Flushed {
+		t.Fatal("SetResponseWrapper() failed")
+	}
+	if !strings.HasSuffix(rec.Body.String(), "Handler 'deferred' reporting in.\n") {
+		t.Fatal("SetResponseWrapper() failed")
+	}
+}
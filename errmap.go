@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// MapError maps errors matching target, as by errors.Is, to HTTP status
+// code status. See MapErrorFunc.
+func (c *Chain) MapError(target error, status int) {
+	c.MapErrorFunc(func(err error) (int, bool) {
+		return status, errors.Is(err, target)
+	})
+}
+
+// MapErrorFunc registers fn which maps errors to HTTP status codes. fn
+// returns the status code and true if it maps the error or false if it
+// does not.
+//
+// Once any mapping is registered with MapError or MapErrorFunc, the status
+// code of a run that finished with an error is resolved by consulting the
+// mappings in order as they were registered, the first match wins, or is
+// 500 Internal Server Error if no mapping matches. The status code is
+// reported by RunResult and ErrorStatusCounts and, if no error handler was
+// set with SetErrorHandler and the response was not yet written, written
+// as the response along with its status text.
+// MapErrorFunc shares the lock with ServeHTTP.
+func (c *Chain) MapErrorFunc(fn func(error) (int, bool)) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.errmap = append(c.errmap, fn)
+}
+
+// ErrorStatusCounts returns the number of runs that finished with an
+// error keyed by the status code resolved by error mappings or nil if no
+// mappings were registered with MapError or MapErrorFunc.
+func (c *Chain) ErrorStatusCounts() map[int]uint64 {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if c.statuses == nil {
+		return nil
+	}
+	r := make(map[int]uint64, len(c.statuses))
+	for status, count := range c.statuses {
+		r[status] = atomic.LoadUint64(count)
+	}
+	return r
+}
+
+// resolveStatus returns the status code err maps to and records it or
+// returns 0 if no error mappings were registered.
+// runmu must be locked by the caller.
+func (c *Chain) resolveStatus(err error) int {
+	if len(c.errmap) == 0 {
+		return 0
+	}
+	status := http.StatusInternalServerError
+	for _, fn := range c.errmap {
+		if mapped, ok := fn(err); ok {
+			status = mapped
+			break
+		}
+	}
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	c.status = status
+	if c.statuses == nil {
+		c.statuses = make(map[int]*uint64)
+	}
+	count, exists := c.statuses[status]
+	if !exists {
+		count = new(uint64)
+		c.statuses[status] = count
+	}
+	atomic.AddUint64(count, 1)
+	return status
+}
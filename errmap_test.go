@@ -0,0 +1,81 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMapError(t *testing.T) {
+
+	var (
+		errNotFound  = errors.New("not found")
+		errForbidden = errors.New("forbidden")
+		errTeapot    = errors.New("teapot")
+	)
+	failWith := func(err error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain, _ := Unpack(r, testkey)
+			chain.SetError(err)
+		})
+	}
+
+	run := func(c *Chain, err error) (*httptest.ResponseRecorder, RunResult) {
+		c.Override("fail", failWith(err))
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, MakeRequest("/"))
+		return rec, c.LastRun()
+	}
+
+	c := New(testkey)
+	c.Append("fail", failWith(nil))
+	if _, result := run(c, errNotFound); result.Status != 0 || c.ErrorStatusCounts() != nil {
+		t.Fatal("MapError() failed, status resolved without mappings")
+	}
+
+	c.MapError(errNotFound, http.StatusNotFound)
+	c.MapErrorFunc(func(err error) (int, bool) {
+		if errors.Is(err, errTeapot) || errors.Is(err, errNotFound) {
+			return http.StatusTeapot, true
+		}
+		return 0, false
+	})
+	c.MapError(errTeapot, http.StatusBadRequest)
+
+	rec, result := run(c, fmt.Errorf("lookup: %w", errNotFound))
+	if rec.Code != http.StatusNotFound || result.Status != http.StatusNotFound ||
+		rec.Body.String() != http.StatusText(http.StatusNotFound)+"\n" {
+		t.Fatal("MapError() failed to match wrapped error")
+	}
+	if rec, result = run(c, errTeapot); rec.Code != http.StatusTeapot || result.Status != http.StatusTeapot {
+		t.Fatal("MapErrorFunc() failed or took wrong precedence")
+	}
+	if rec, result = run(c, errForbidden); rec.Code != http.StatusInternalServerError ||
+		result.Status != http.StatusInternalServerError {
+		t.Fatal("MapError() failed to fall back to 500")
+	}
+	if rec, result = run(c, nil); rec.Code != http.StatusOK || result.Status != 0 {
+		t.Fatal("MapError() failed on success")
+	}
+	counts := c.ErrorStatusCounts()
+	if len(counts) != 3 || counts[http.StatusNotFound] != 1 || counts[http.StatusTeapot] != 1 ||
+		counts[http.StatusInternalServerError] != 1 {
+		t.Fatalf("ErrorStatusCounts() failed: %v", counts)
+	}
+
+	var handled int
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		chain, _ := Unpack(r, testkey)
+		handled = chain.LastRun().Status
+		w.WriteHeader(http.StatusConflict)
+	})
+	if rec, _ = run(c, errNotFound); rec.Code != http.StatusConflict || handled != http.StatusNotFound {
+		t.Fatal("MapError() failed with error handler")
+	}
+}
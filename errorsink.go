@@ -0,0 +1,139 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorSinkFlushTimeout is the maximum time Close waits for queued error
+// reports to be delivered to the error sink.
+const ErrorSinkFlushTimeout = 5 * time.Second
+
+// ErrorReport describes a run that finished with an error.
+type ErrorReport struct {
+	// Err is the error the run finished with.
+	Err error
+	// Path is the name of the handler that set the error or an empty
+	// string if it was set outside of a handler.
+	Path string
+	// Method is the request method.
+	Method string
+	// URL is the request URL path.
+	URL string
+	// Trace are the names of handlers in order as they were executed.
+	Trace []string
+	// Time is the time the run finished.
+	Time time.Time
+}
+
+// errorSink delivers error reports to a function from a goroutine.
+type errorSink struct {
+	fn    func(ErrorReport)
+	queue chan ErrorReport
+	stop  chan time.Time
+	done  chan struct{}
+}
+
+// SetErrorSink sets a function to which reports of runs that finished
+// with an error are delivered asynchronously by a single goroutine.
+// Reports are queued at the end of a run without blocking it; if queue
+// reports are already waiting the report is dropped and counted, see
+// DroppedErrorReports. Panics in fn are recovered and the report is
+// discarded. Close stops the sink after delivering queued reports for at
+// most ErrorSinkFlushTimeout. A nil fn stops the current sink the same way.
+func (c *Chain) SetErrorSink(fn func(ErrorReport), queue int) {
+	var sink *errorSink
+	if fn != nil {
+		if queue < 1 {
+			queue = 1
+		}
+		sink = &errorSink{
+			fn:    fn,
+			queue: make(chan ErrorReport, queue),
+			stop:  make(chan time.Time, 1),
+			done:  make(chan struct{}),
+		}
+		go sink.run()
+	}
+	c.varmu.Lock()
+	old := c.sink
+	c.sink = sink
+	c.varmu.Unlock()
+	if old != nil {
+		old.close(ErrorSinkFlushTimeout)
+	}
+}
+
+// DroppedErrorReports returns the number of error reports dropped because
+// the error sink queue was full.
+func (c *Chain) DroppedErrorReports() uint64 {
+	return atomic.LoadUint64(&c.sinkdrop)
+}
+
+// reportError queues a report of the finished run if it failed and an
+// error sink is set. varmu must be locked by the caller.
+func (c *Chain) reportError(r *http.Request) {
+	if c.sink == nil || c.err == nil {
+		return
+	}
+	trace := make([]string, len(c.trace))
+	copy(trace, c.trace)
+	report := ErrorReport{
+		Err:    c.err,
+		Path:   c.errpath,
+		Method: r.Method,
+		URL:    r.URL.Path,
+		Trace:  trace,
+		Time:   c.now(),
+	}
+	select {
+	case c.sink.queue <- report:
+	default:
+		atomic.AddUint64(&c.sinkdrop, 1)
+	}
+}
+
+// run delivers reports until stopped then flushes the queue until the
+// received deadline.
+func (sink *errorSink) run() {
+	defer close(sink.done)
+	for {
+		select {
+		case report := <-sink.queue:
+			sink.deliver(report)
+		case deadline := <-sink.stop:
+			for time.Now().Before(deadline) {
+				select {
+				case report := <-sink.queue:
+					sink.deliver(report)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// deliver delivers report to the sink function recovering from panics.
+func (sink *errorSink) deliver(report ErrorReport) {
+	defer func() { recover() }()
+	sink.fn(report)
+}
+
+// close stops the sink and waits at most timeout for queued reports to be
+// delivered.
+func (sink *errorSink) close(timeout time.Duration) {
+	sink.stop <- time.Now().Add(timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-sink.done:
+	case <-timer.C:
+	}
+}
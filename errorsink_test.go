@@ -0,0 +1,92 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestErrorSink(t *testing.T) {
+
+	var (
+		mu      sync.Mutex
+		reports []ErrorReport
+	)
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.SetErrorSink(func(report ErrorReport) {
+		mu.Lock()
+		reports = append(reports, report)
+		mu.Unlock()
+		if report.URL == "/panic" {
+			panic("sink")
+		}
+	}, 8)
+
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/panic"))
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reports) == 2
+	})
+	mu.Lock()
+	report := reports[1]
+	mu.Unlock()
+	if report.Err == nil || report.Path != "h2" || report.Method != "GET" || report.URL != "/" ||
+		strings.Join(report.Trace, ",") != "h1,h2" || report.Time.IsZero() {
+		t.Fatal("SetErrorSink() failed")
+	}
+	c.Close()
+}
+
+func TestErrorSinkDropAndFlush(t *testing.T) {
+
+	var (
+		mu        sync.Mutex
+		delivered int
+	)
+	block := make(chan struct{})
+	c := New(testkey)
+	c.Append("h1", MakeHandlerThatSetsAnError("h1"))
+	c.SetErrorSink(func(report ErrorReport) {
+		<-block
+		mu.Lock()
+		delivered++
+		mu.Unlock()
+	}, 2)
+
+	// First report is taken by the sink goroutine, two are queued and the
+	// rest are dropped. Wait for the sink to pick up the first report.
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	waitFor(t, func() bool {
+		c.varmu.Lock()
+		defer c.varmu.Unlock()
+		return len(c.sink.queue) == 0
+	})
+	for i := 0; i < 5; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	}
+	if n := c.DroppedErrorReports(); n != 3 {
+		t.Fatalf("DroppedErrorReports() failed, got %d", n)
+	}
+
+	close(block)
+	c.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if delivered != 3 {
+		t.Fatalf("Close() failed to flush, delivered %d", delivered)
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), makeRequest("/"))
+	if c.LastError() == nil || c.DroppedErrorReports() != 3 {
+		t.Fatal("ServeHTTP() failed after Close()")
+	}
+}
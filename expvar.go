@@ -0,0 +1,108 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"expvar"
+	"sync"
+)
+
+// ErrExpvarPublished is returned by PublishExpvar if an expvar with the
+// same name is already published.
+var ErrExpvarPublished = ErrChainer.WrapFormat("expvar '%s' already published")
+
+// expvarSlot is a published expvar reading a chain variable.
+type expvarSlot struct {
+	chain *Chain
+	key   string
+}
+
+var (
+	// expvarmu guards expvars.
+	expvarmu sync.Mutex
+	// expvars holds slots published by chains keyed by expvar name.
+	// Slots are never removed as expvar does not support removal.
+	expvars = make(map[string]*expvarSlot)
+)
+
+// PublishExpvar publishes chain variables with specified keys as expvars
+// named prefix followed by a dot and the key. Published values are read
+// live from the chain's own variables, processed by the variable redactor
+// as described by WithVarRedactor, and are null if the variable is not
+// set or was omitted by the redactor.
+//
+// If an expvar with any of the names is already published, by this or
+// any other package, nothing is published and ErrExpvarPublished sibling
+// is returned. Names released by UnpublishExpvar can be published again.
+func (c *Chain) PublishExpvar(prefix string, keys ...string) error {
+	expvarmu.Lock()
+	defer expvarmu.Unlock()
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := prefix + "." + key
+		if slot, exists := expvars[name]; exists && slot.chain == nil {
+			names = append(names, name)
+			continue
+		}
+		if expvar.Get(name) != nil {
+			return ErrExpvarPublished.WrapArgs(name)
+		}
+		names = append(names, name)
+	}
+	for i, name := range names {
+		slot, exists := expvars[name]
+		if !exists {
+			slot = &expvarSlot{}
+			expvars[name] = slot
+			expvar.Publish(name, expvar.Func(func() interface{} { return slot.value() }))
+		}
+		slot.chain, slot.key = c, keys[i]
+	}
+	c.varmu.Lock()
+	c.published = append(c.published, names...)
+	c.varmu.Unlock()
+	return nil
+}
+
+// UnpublishExpvar releases all expvars published by the chain. Released
+// expvars remain registered with expvar, as it does not support removal,
+// but report null until published again.
+func (c *Chain) UnpublishExpvar() {
+	expvarmu.Lock()
+	defer expvarmu.Unlock()
+
+	c.varmu.Lock()
+	names := c.published
+	c.published = nil
+	c.varmu.Unlock()
+	for _, name := range names {
+		if slot := expvars[name]; slot.chain == c {
+			slot.chain = nil
+		}
+	}
+}
+
+// value returns the current value of the variable published by slot.
+func (slot *expvarSlot) value() interface{} {
+	expvarmu.Lock()
+	chain, key := slot.chain, slot.key
+	expvarmu.Unlock()
+	if chain == nil {
+		return nil
+	}
+
+	chain.varmu.Lock()
+	val, exists := chain.vars[key]
+	if exists {
+		val = copyVar(val)
+	}
+	chain.varmu.Unlock()
+	if !exists {
+		return nil
+	}
+	val, _ = chain.redact(key, val)
+	return val
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"expvar"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+
+	get := func(name string) string {
+		v := expvar.Get(name)
+		if v == nil {
+			t.Fatalf("expvar '%s' not published", name)
+		}
+		return v.String()
+	}
+
+	c := New(testkey)
+	c.Set("hits", 1)
+	c.Set("token", "s3cr3t")
+	if err := c.PublishExpvar("chainer_test", "hits", "token", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if get("chainer_test.hits") != "1" || get("chainer_test.token") != `"[REDACTED]"` || get("chainer_test.hash") != "null" {
+		t.Fatal("PublishExpvar() failed")
+	}
+	c.Set("hits", 2)
+	c.Set("hash", "abc")
+	if get("chainer_test.hits") != "2" || get("chainer_test.hash") != `"abc"` {
+		t.Fatal("PublishExpvar() failed to track Set")
+	}
+
+	other := New(testkey)
+	other.Set("hits", 100)
+	if err := other.PublishExpvar("chainer_test", "hits"); !errors.Is(err, ErrExpvarPublished) {
+		t.Fatal("PublishExpvar() failed")
+	}
+	expvar.NewInt("chainer_test_foreign.hits")
+	if err := other.PublishExpvar("chainer_test_foreign", "hits"); !errors.Is(err, ErrExpvarPublished) {
+		t.Fatal("PublishExpvar() failed")
+	}
+
+	c.UnpublishExpvar()
+	if get("chainer_test.hits") != "null" {
+		t.Fatal("UnpublishExpvar() failed")
+	}
+	if err := other.PublishExpvar("chainer_test", "hits"); err != nil || get("chainer_test.hits") != "100" {
+		t.Fatal("PublishExpvar() failed to reuse released name")
+	}
+	other.UnpublishExpvar()
+}
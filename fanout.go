@@ -0,0 +1,151 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBodyTooLarge is returned when a request body exceeds a size limit.
+var ErrBodyTooLarge = ErrChainer.WrapFormat("request body larger than %d bytes")
+
+// ErrFanOutPanic is the error of a FanOutResult of a chain that panicked.
+var ErrFanOutPanic = ErrChainer.WrapFormat("chain '%s' panicked: %v")
+
+// FanOutVar is the name of the chain variable under which a FanOut handler
+// stores a FanOutReport.
+const FanOutVar = "chainer.fanout"
+
+// DefaultFanOutBodyLimit is the request body size limit used by FanOut.
+const DefaultFanOutBodyLimit = 1 << 20
+
+// FanOutResult is the result of a chain run by a FanOut handler.
+type FanOutResult struct {
+	// Status is the response status written by the chain.
+	Status int `json:"status"`
+	// Error is the text of Err, if any.
+	Error string `json:"error,omitempty"`
+	// Err is the chain error, if any.
+	Err error `json:"-"`
+}
+
+// FanOutReport holds FanOutResults keyed by chain name.
+type FanOutReport map[string]FanOutResult
+
+// Failed returns true if any of the chains failed.
+func (fr FanOutReport) Failed() bool {
+	for _, result := range fr {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FanOut returns a handler that runs the request through all chains using
+// at most concurrency goroutines, or one per chain if concurrency is less
+// than 1. See FanOutWith for details.
+func FanOut(chains map[string]*Chain, concurrency int) http.Handler {
+	return FanOutWith(chains, concurrency, DefaultFanOutBodyLimit, nil)
+}
+
+// FanOutWith returns a handler that runs the request through all chains
+// using at most concurrency goroutines, or one per chain if concurrency
+// is less than 1.
+//
+// Request body is read once, up to maxBody bytes, and each chain receives
+// its own reader of it. If the body is larger, the handler responds with
+// 413 Request Entity Too Large and sets ErrBodyTooLarge as the chain error.
+// Each chain writes to its own buffer which is discarded. Panics in chains
+// are recovered as they are run in their own goroutines; the result of a
+// chain that panicked has status 500 and ErrFanOutPanic sibling as error.
+//
+// Once all chains finish, a FanOutReport is stored in the variables of the
+// chain executing the handler under FanOutVar and passed to responder.
+// If responder is nil the report is written as JSON with status 200 OK if
+// all chains succeeded or 500 Internal Server Error otherwise.
+func FanOutWith(chains map[string]*Chain, concurrency int, maxBody int64,
+	responder func(w http.ResponseWriter, r *http.Request, report FanOutReport)) http.Handler {
+	if concurrency < 1 || concurrency > len(chains) {
+		concurrency = len(chains)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, hasParent := FromContext(r.Context())
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+			if err == nil && int64(len(body)) > maxBody {
+				err = ErrBodyTooLarge.WrapArgs(maxBody)
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				if hasParent {
+					parent.SetError(err)
+				}
+				return
+			}
+		}
+
+		report := make(FanOutReport, len(chains))
+		mu := sync.Mutex{}
+		wg := sync.WaitGroup{}
+		sem := make(chan struct{}, concurrency)
+		for name, chain := range chains {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(name string, chain *Chain) {
+				var result FanOutResult
+				defer func() {
+					if v := recover(); v != nil {
+						result = FanOutResult{
+							Status: http.StatusInternalServerError,
+							Err:    ErrFanOutPanic.WrapArgs(name, v),
+						}
+					}
+					if result.Err != nil {
+						result.Error = result.Err.Error()
+					}
+					mu.Lock()
+					report[name] = result
+					mu.Unlock()
+					<-sem
+					wg.Done()
+				}()
+				req := r.Clone(r.Context())
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.ContentLength = int64(len(body))
+				rec := newBufferWriter()
+				out := chain.serve(nil, time.Time{}, rec, req)
+				result = FanOutResult{Status: rec.code(), Err: out.err}
+			}(name, chain)
+		}
+		wg.Wait()
+
+		if hasParent {
+			parent.Set(FanOutVar, report)
+		}
+		if responder != nil {
+			responder(w, r, report)
+			return
+		}
+		data, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if report.Failed() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write(data)
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFanOut(t *testing.T) {
+
+	const body = "event payload"
+
+	mu := sync.Mutex{}
+	bodies := make(map[string]string)
+	makeReader := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies[name] = string(data)
+			mu.Unlock()
+			w.Write([]byte("isolated output"))
+		})
+	}
+
+	chains := make(map[string]*Chain)
+	for _, name := range []string{"audit", "analytics", "storage"} {
+		chains[name] = New(testkey)
+		chains[name].Append("reader", makeReader(name))
+	}
+	chains["storage"].Append("fail", MakeHandlerThatSetsAnError("fail"))
+
+	c := New(testkey)
+	c.Append("fanout", FanOut(chains, 2))
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+
+	for name := range chains {
+		if bodies[name] != body {
+			t.Fatalf("FanOut() failed to pass body to %s", name)
+		}
+	}
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "isolated output") {
+		t.Fatal("FanOut() failed to isolate chains")
+	}
+	summary := make(map[string]FanOutResult)
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 3 || summary["storage"].Error == "" || summary["audit"].Error != "" {
+		t.Fatal("FanOut() failed to write summary")
+	}
+	v, ok := c.Get(FanOutVar)
+	if !ok {
+		t.Fatal("FanOut() failed to store report")
+	}
+	report := v.(FanOutReport)
+	if !report.Failed() || report["storage"].Err == nil || report["analytics"].Err != nil {
+		t.Fatal("FanOut() failed to store report")
+	}
+}
+
+func TestFanOutBodyTooLarge(t *testing.T) {
+
+	chain := New(testkey)
+	chain.Append("h1", MakeHandler("h1"))
+	c := New(testkey)
+	c.Append("fanout", FanOutWith(map[string]*Chain{"one": chain}, 0, 4, nil))
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("too large"))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || !errors.Is(c.LastError(), ErrBodyTooLarge) {
+		t.Fatal("FanOutWith() failed")
+	}
+}
+
+func TestFanOutPanic(t *testing.T) {
+
+	chains := map[string]*Chain{
+		"ok":    New(testkey),
+		"panic": New(testkey),
+	}
+	chains["ok"].Append("h1", MakeHandler("h1"))
+	chains["panic"].Append("boom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	c := New(testkey)
+	c.Append("fanout", FanOut(chains, 0))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+
+	report, _ := c.Get(FanOutVar)
+	result := report.(FanOutReport)["panic"]
+	if !errors.Is(result.Err, ErrFanOutPanic) || result.Status != http.StatusInternalServerError ||
+		!strings.Contains(result.Error, "boom") {
+		t.Fatalf("FanOut() failed to recover: %+v", result)
+	}
+	if report.(FanOutReport)["ok"].Err != nil || rec.Code != http.StatusInternalServerError {
+		t.Fatal("FanOut() failed")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"time"
+)
+
+// features is a set of optional per-link features active in a run.
+//
+// It is evaluated once at the start of every run so that the handler loop
+// of a chain without optional features configured executes no feature
+// related locking, lookups or interface calls beyond the handlers.
+// Consequently configuration changes made during a run take effect in the
+// next run, except for Disable which is always effective immediately.
+type features uint32
+
+const (
+	// featMethods checks method restrictions set by AppendMethod.
+	featMethods features = 1 << iota
+	// featDeadline checks the deadline set by ServeWithDeadline.
+	featDeadline
+	// featDisabled skips handlers disabled by Disable. Handlers disabled
+	// during a run are detected using Chain.disabling.
+	featDisabled
+	// featCounters counts executions, see WithCounters.
+	featCounters
+	// featTrace records the trace, see WithTraceLimit.
+	featTrace
+	// featObserver reports to the Observer set by WithObserver.
+	featObserver
+	// featStats records execution durations, see Stats.
+	featStats
+	// featHooks calls internal link hooks.
+	featHooks
+	// featMetrics reports to Metrics set by SetMetrics.
+	featMetrics
+	// featDiag logs diagnostic warnings, see WithLogger.
+	featDiag
+	// featClientGone watches for client disconnects, see OnClientGone.
+	featClientGone
+)
+
+// has returns true if all of f are in fs.
+func (fs features) has(f features) bool { return fs&f == f }
+
+// features returns the features active in a run that is sampled as
+// specified and ends at deadline if not zero. runmu must be locked by
+// the caller.
+func (c *Chain) features(sampled bool, deadline time.Time) (fs features) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if len(c.methods) > 0 {
+		fs |= featMethods
+	}
+	if !deadline.IsZero() {
+		fs |= featDeadline
+	}
+	if len(c.disabled) > 0 {
+		fs |= featDisabled
+	}
+	if c.counting {
+		fs |= featCounters
+	}
+	if len(c.linkhooks) > 0 {
+		fs |= featHooks
+	}
+	if c.metrics != nil {
+		fs |= featMetrics
+	}
+	if c.diaglog != nil {
+		fs |= featDiag
+	}
+	if c.ongone != nil {
+		fs |= featClientGone
+	}
+	if !sampled {
+		return
+	}
+	if c.tracelimit > 0 {
+		fs |= featTrace
+	}
+	if _, nop := c.observer.(NopObserver); !nop && c.observer != nil {
+		fs |= featObserver
+	}
+	fs |= featStats
+	return
+}
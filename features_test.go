@@ -0,0 +1,93 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeatures(t *testing.T) {
+
+	unsampled := func(*http.Request) bool { return false }
+	for _, test := range []struct {
+		name    string
+		feature features
+		sampled bool // sampled is true if the feature requires sampling.
+		setup   func(c *Chain)
+	}{
+		{"methods", featMethods, false, func(c *Chain) { c.AppendMethod("GET", "get", MakeHandler("get")) }},
+		{"disabled", featDisabled, false, func(c *Chain) { c.Disable("h1") }},
+		{"counters", featCounters, false, func(c *Chain) { WithCounters()(c) }},
+		{"trace", featTrace, true, func(c *Chain) {}},
+		{"observer", featObserver, true, func(c *Chain) { WithObserver(&testObserver{})(c) }},
+		{"stats", featStats, true, func(c *Chain) {}},
+		{"hooks", featHooks, false, func(c *Chain) {
+			hook := linkHook(func(string, error, bool) {})
+			c.linkhooks = append(c.linkhooks, &hook)
+		}},
+		{"metrics", featMetrics, false, func(c *Chain) { c.SetMetrics(&testMetrics{}) }},
+		{"diag", featDiag, false, func(c *Chain) { WithLogger(&testLogger{})(c) }},
+		{"clientgone", featClientGone, false, func(c *Chain) { c.OnClientGone(func(*http.Request, string) {}) }},
+	} {
+		c := New(testkey, WithObservabilitySampling(unsampled))
+		c.Append("h1", MakeHandler("h1"))
+		if fs := c.features(false, time.Time{}); fs.has(test.feature) {
+			t.Fatalf("features() failed, %s active without configuration", test.name)
+		}
+		test.setup(c)
+		if fs := c.features(test.sampled, time.Time{}); !fs.has(test.feature) {
+			t.Fatalf("features() failed, %s not active", test.name)
+		}
+	}
+
+	c := New(testkey)
+	if fs := c.features(false, time.Time{}); fs != 0 {
+		t.Fatal("features() failed")
+	}
+	if fs := c.features(false, time.Now()); fs != featDeadline {
+		t.Fatal("features() failed")
+	}
+	if fs := c.features(true, time.Time{}); fs != featTrace|featStats {
+		t.Fatal("features() failed")
+	}
+
+	// Disable called during a run is effective immediately.
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := Unpack(r, testkey)
+		chain.Disable("h2")
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if trace := c.LastRun().Trace; len(trace) != 1 || trace[0] != "h1" {
+		t.Fatal("Disable() failed during run")
+	}
+}
+
+func benchmarkFeatures(b *testing.B, options ...Option) {
+	c := New(testkey, options...)
+	for i := 0; i < 3; i++ {
+		c.Append(string(rune('a'+i)), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	}
+	w, r := httptest.NewRecorder(), MakeRequest("/")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkFeatureFree(b *testing.B) {
+	benchmarkFeatures(b, WithObservabilitySampling(func(*http.Request) bool { return false }))
+}
+
+func BenchmarkFeatureDefault(b *testing.B) {
+	benchmarkFeatures(b)
+}
+
+func BenchmarkFeatureAll(b *testing.B) {
+	benchmarkFeatures(b, WithCounters(), WithObserver(&NopObserver{}), WithLogger(&testLogger{}))
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Fingerprint returns a hash of the chain structure that can be used to
+// detect whether two chains, possibly built by different processes, are
+// structurally identical. It covers, in order, the names of handlers as
+// registered, the type of each handler, method restrictions, terminal
+// marks, barriers and disabled states of handlers, entry points and the
+// structure of nested chains, including those appended by AppendPrefix
+// and GroupWith.
+//
+// Handlers are identified by their type only, so replacing a handler
+// with a different instance of the same type, for instance another
+// http.HandlerFunc, does not change the fingerprint. Variables, options,
+// callbacks such as error handlers and post-run handlers, statistics and
+// per-run state are not covered. Fingerprint shares the lock with
+// ServeHTTP.
+func (c *Chain) Fingerprint() uint64 {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	h := fnv.New64a()
+	c.fingerprint(h, []*Chain{c})
+	return h.Sum64()
+}
+
+// fingerprint writes the chain structure to h. active are chains being
+// fingerprinted, c and its ancestors from the outermost, whose runmu is
+// locked. A chain nested in itself is written as the depth of its
+// ancestor. runmu must be locked by the caller.
+func (c *Chain) fingerprint(h hash.Hash64, active []*Chain) {
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	c.varmu.Lock()
+	for i, link := range c.links {
+		if i >= len(c.indexes) {
+			break
+		}
+		key := c.indexes[i]
+		write(c.spells[key])
+		write(handlerType(link))
+		write(c.methods[key])
+		write(strconv.FormatBool(c.marks[key]))
+		write(strconv.FormatBool(c.barriers[key]))
+		write(strconv.FormatBool(c.disabled[key]))
+	}
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		write(path)
+		write(c.entries[path])
+	}
+	c.varmu.Unlock()
+
+	for _, link := range c.links {
+		var nested *Chain
+		switch handler := link.(type) {
+		case *Chain:
+			nested = handler
+		case *prefixHandler:
+			write(handler.prefix)
+			nested = handler.chain
+		default:
+			continue
+		}
+		if depth := chainIndex(active, nested); depth >= 0 {
+			write("cycle " + strconv.Itoa(depth))
+			continue
+		}
+		write("(")
+		nested.runmu.Lock()
+		nested.fingerprint(h, append(active, nested))
+		nested.runmu.Unlock()
+		write(")")
+	}
+}
+
+// chainIndex returns the index of c in chains or -1 if not found.
+func chainIndex(chains []*Chain, c *Chain) int {
+	for i, chain := range chains {
+		if chain == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+
+	build := func() *Chain {
+		sub := New(testkey)
+		sub.Append("s1", MakeHandler("s1"))
+		c := New(testkey)
+		c.Append("h1", MakeHandler("h1"))
+		c.AppendPrefix("/api", sub)
+		c.AppendMethod("GET", "h2", newTestHandler("h2"))
+		c.Append("h3", MakeHandler("h3"))
+		return c
+	}
+
+	c := build()
+	fp := c.Fingerprint()
+	if build().Fingerprint() != fp {
+		t.Fatal("Fingerprint() failed, identical chains differ")
+	}
+	if c.Clone().Fingerprint() != fp {
+		t.Fatal("Fingerprint() failed, Clone differs")
+	}
+	c.Set("var", 1)
+	c.SetErrorHandler(nil)
+	if c.Fingerprint() != fp {
+		t.Fatal("Fingerprint() failed, vars changed it")
+	}
+
+	for name, change := range map[string]func(c *Chain){
+		"rename": func(c *Chain) {
+			c.InjectBefore("h3", "h4", func(h http.Handler) http.Handler { return h })
+		},
+		"reorder": func(c *Chain) { c.Reorder([]string{"h1", "/api", "h3", "h2"}) },
+		"replace": func(c *Chain) {
+			c.InjectBefore("h2", "h2", func(http.Handler) http.Handler { return MakeHandler("h2") })
+		},
+		"disable": func(c *Chain) { c.Disable("h1") },
+		"nested": func(c *Chain) {
+			_, h, _ := c.GetAt(1)
+			h.(*prefixHandler).chain.Append("s2", MakeHandler("s2"))
+		},
+	} {
+		other := build()
+		change(other)
+		if other.Fingerprint() == fp {
+			t.Fatalf("Fingerprint() failed to detect %s", name)
+		}
+	}
+}
+
+func TestFingerprintCycle(t *testing.T) {
+
+	self, mutual := cyclicChains()
+	var selfSum, mutualSum uint64
+	within(t, func() {
+		selfSum = self.Fingerprint()
+		mutualSum = mutual.Fingerprint()
+	})
+	if selfSum == 0 || selfSum == mutualSum {
+		t.Fatal("Fingerprint() failed")
+	}
+	if self.Fingerprint() != selfSum || mutual.Fingerprint() != mutualSum {
+		t.Fatal("Fingerprint() failed")
+	}
+}
+
+func TestFingerprintNilHandler(t *testing.T) {
+
+	c, other := New(testkey), New(testkey)
+	c.Append("h1", nil)
+	other.Append("h1", MakeHandler("h1"))
+	if c.Fingerprint() == other.Fingerprint() {
+		t.Fatal("Fingerprint() failed")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/vedranvuk/chainer
 
-go 1.14
+go 1.21
 
 require (
 	github.com/vedranvuk/errorex v0.3.0
@@ -0,0 +1,41 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RewritePath returns a handler that replaces the from prefix of the
+// request URL path with to for handlers following it in the chain.
+// Requests whose path does not start with from are left unchanged.
+//
+// The chain passes the same request to all of its handlers so the
+// rewritten path is visible to all handlers that follow, including
+// nested chains, but not to the caller of the chain.
+func RewritePath(from, to string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, from) {
+			setPath(r, to+strings.TrimPrefix(r.URL.Path, from))
+		}
+	})
+}
+
+// RewritePathRegexp returns a handler that replaces matches of re in the
+// request URL path with repl, as by regexp.ReplaceAllString, for handlers
+// following it in the chain. See RewritePath for details.
+func RewritePathRegexp(re *regexp.Regexp, repl string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setPath(r, re.ReplaceAllString(r.URL.Path, repl))
+	})
+}
+
+// setPath sets the path of r and clears its raw path.
+func setPath(r *http.Request, path string) {
+	r.URL.Path = path
+	r.URL.RawPath = ""
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRewritePath(t *testing.T) {
+
+	var got string
+	c := New(testkey)
+	c.Append("rewrite", RewritePath("/old/", "/new/"))
+	c.Append("regexp", RewritePathRegexp(regexp.MustCompile(`/v[0-9]+/`), "/latest/"))
+	c.Append("reader", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Path
+	}))
+
+	for path, want := range map[string]string{
+		"/old/users":    "/new/users",
+		"/other/users":  "/other/users",
+		"/old/v2/users": "/new/latest/users",
+	} {
+		req := MakeRequest(path)
+		c.ServeHTTP(httptest.NewRecorder(), req)
+		if got != want {
+			t.Fatalf("RewritePath() failed, got %s, want %s", got, want)
+		}
+		if req.URL.Path != path {
+			t.Fatal("RewritePath() modified caller request")
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// HandlerHealthMonitor monitors error rates of handlers in a chain and
+// automatically disables handlers whose error rate exceeds a threshold.
+//
+// Each handler's outcomes are tracked over a sliding window of its last
+// windowSize executions. Once the window is full and the error rate
+// exceeds the threshold, the monitor marks the handler as unhealthy and
+// calls the function set by SetOnUnhealthy. The handler is marked as
+// healthy again once the error rate over a full window does not exceed
+// the threshold.
+//
+// Unhealthy handlers are disabled with Chain.Disable and their circuit is
+// open, unless they were opted out with ReportOnly. After the disabled
+// handler was skipped windowSize times the monitor enables it on
+// probation. If the error rate over the next full window does not exceed
+// the recovery threshold, which is half of the threshold, the circuit
+// closes, otherwise the handler is disabled again. Handlers marked as barriers with
+// MarkBarrier are never disabled as handlers such as authentication or
+// input validation fail on bad client input by design.
+//
+// The monitor processes outcomes in a background goroutine stopped by
+// Close. Outcomes are passed to it without blocking the chain; if the
+// goroutine falls behind by more than healthEventBuffer outcomes, further
+// outcomes are dropped and counted by Dropped.
+type HandlerHealthMonitor struct {
+	chain     *Chain
+	threshold float64
+	size      int
+	linkhook  linkHook
+
+	events  chan healthEvent
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+
+	mu          sync.Mutex
+	windows     map[string]*healthWindow
+	reportonly  map[string]bool
+	onunhealthy func(name string, rate float64)
+}
+
+// healthEventBuffer is the number of handler outcomes a
+// HandlerHealthMonitor buffers before it drops outcomes.
+const healthEventBuffer = 1024
+
+// linkHook is called by a chain with the outcome of each link execution.
+type linkHook func(name string, err error, skipped bool)
+
+// healthEvent is an outcome of a handler execution.
+type healthEvent struct {
+	name    string
+	failed  bool
+	skipped bool
+}
+
+// healthWindow is a sliding window of handler outcomes.
+type healthWindow struct {
+	results   []bool
+	next      int
+	filled    int
+	failures  int
+	skipped   int
+	unhealthy bool
+	open      bool
+	probation bool
+}
+
+// add adds an outcome to the window.
+func (hw *healthWindow) add(failed bool) {
+	if hw.filled == len(hw.results) && hw.results[hw.next] {
+		hw.failures--
+	}
+	if hw.filled < len(hw.results) {
+		hw.filled++
+	}
+	hw.results[hw.next] = failed
+	if failed {
+		hw.failures++
+	}
+	hw.next = (hw.next + 1) % len(hw.results)
+}
+
+// reset clears the window.
+func (hw *healthWindow) reset() {
+	for i := range hw.results {
+		hw.results[i] = false
+	}
+	hw.next, hw.filled, hw.failures, hw.skipped = 0, 0, 0, 0
+}
+
+// NewHandlerHealthMonitor returns a new HandlerHealthMonitor that monitors
+// handlers of c over windows of windowSize executions and disables them if
+// their error rate, 0 to 1, exceeds threshold. A windowSize less than 1
+// is treated as 1.
+func NewHandlerHealthMonitor(c *Chain, threshold float64, windowSize int) *HandlerHealthMonitor {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	hm := &HandlerHealthMonitor{
+		chain:      c,
+		threshold:  threshold,
+		size:       windowSize,
+		events:     make(chan healthEvent, healthEventBuffer),
+		done:       make(chan struct{}),
+		windows:    make(map[string]*healthWindow),
+		reportonly: make(map[string]bool),
+	}
+	hm.linkhook = hm.hook
+	c.varmu.Lock()
+	c.linkhooks = append(c.linkhooks, &hm.linkhook)
+	c.varmu.Unlock()
+	go hm.run()
+	return hm
+}
+
+// ReportOnly opts handlers registered under names out of being disabled
+// by the monitor. Their error rates are still monitored and reported by
+// IsUnhealthy and the function set by SetOnUnhealthy. If a name is not
+// registered ErrInvalidName sibling is returned and no handlers are
+// opted out.
+func (hm *HandlerHealthMonitor) ReportOnly(names ...string) error {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, exists := hm.chain.IndexOf(name); !exists {
+			return ErrInvalidName.WrapArgs(name)
+		}
+		keys = append(keys, hm.chain.normalize(name))
+	}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for _, key := range keys {
+		hm.reportonly[key] = true
+	}
+	return nil
+}
+
+// SetOnUnhealthy sets a function called from the monitor goroutine with
+// the name and the error rate of a handler when its error rate exceeds
+// the threshold. A nil fn removes the function.
+func (hm *HandlerHealthMonitor) SetOnUnhealthy(fn func(name string, rate float64)) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	hm.onunhealthy = fn
+}
+
+// IsUnhealthy returns true if the error rate of the handler registered
+// under name exceeded the threshold over its last full window.
+func (hm *HandlerHealthMonitor) IsUnhealthy(name string) bool {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	hw, exists := hm.windows[hm.chain.normalize(name)]
+	return exists && hw.unhealthy
+}
+
+// IsCircuitOpen returns true if the handler registered under name was
+// disabled by the monitor and not yet enabled on probation.
+func (hm *HandlerHealthMonitor) IsCircuitOpen(name string) bool {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	hw, exists := hm.windows[hm.chain.normalize(name)]
+	return exists && hw.open
+}
+
+// Close stops the monitor and detaches it from the chain. Handlers
+// disabled by the monitor remain disabled.
+func (hm *HandlerHealthMonitor) Close() error {
+	hm.once.Do(func() {
+		hm.chain.varmu.Lock()
+		linkhooks := make([]*linkHook, 0, len(hm.chain.linkhooks))
+		for _, hook := range hm.chain.linkhooks {
+			if hook != &hm.linkhook {
+				linkhooks = append(linkhooks, hook)
+			}
+		}
+		hm.chain.linkhooks = linkhooks
+		hm.chain.varmu.Unlock()
+		close(hm.done)
+	})
+	return nil
+}
+
+// Dropped returns the number of handler outcomes dropped because the
+// monitor goroutine fell behind.
+func (hm *HandlerHealthMonitor) Dropped() uint64 {
+	return atomic.LoadUint64(&hm.dropped)
+}
+
+// hook passes a handler outcome to the monitor goroutine. It is called
+// from the goroutine serving the chain and never blocks; if the buffer is
+// full the outcome is dropped and counted.
+func (hm *HandlerHealthMonitor) hook(name string, err error, skipped bool) {
+	select {
+	case hm.events <- healthEvent{name, err != nil, skipped}:
+	default:
+		atomic.AddUint64(&hm.dropped, 1)
+	}
+}
+
+// run processes handler outcomes until the monitor is closed.
+func (hm *HandlerHealthMonitor) run() {
+	for {
+		select {
+		case ev := <-hm.events:
+			if report := hm.process(ev); report != nil {
+				report()
+			}
+		case <-hm.done:
+			return
+		}
+	}
+}
+
+// process updates the window of a handler with ev and disables or enables
+// the handler as needed. It returns a function that reports the handler
+// as unhealthy to be called without the monitor locked or nil.
+func (hm *HandlerHealthMonitor) process(ev healthEvent) (report func()) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	hw, exists := hm.windows[ev.name]
+	if !exists {
+		hw = &healthWindow{results: make([]bool, hm.size)}
+		hm.windows[ev.name] = hw
+	}
+	if ev.skipped {
+		if hw.open {
+			if hw.skipped++; hw.skipped >= hm.size {
+				hw.open, hw.probation = false, true
+				hw.reset()
+				hm.chain.Enable(ev.name)
+			}
+		}
+		return nil
+	}
+	hw.add(ev.failed)
+	if hw.filled < hm.size {
+		return nil
+	}
+	rate := float64(hw.failures) / float64(hm.size)
+	limit := hm.threshold
+	if hw.probation {
+		limit = hm.threshold / 2
+		hw.probation = false
+	}
+	if hw.unhealthy = rate > limit; !hw.unhealthy {
+		return nil
+	}
+	hw.reset()
+	if !hm.reportonly[ev.name] && !hm.chain.IsBarrier(ev.name) {
+		hw.open = true
+		hm.chain.Disable(ev.name)
+	}
+	if fn := hm.onunhealthy; fn != nil {
+		return func() { fn(ev.name, rate) }
+	}
+	return nil
+}
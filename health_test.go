@@ -0,0 +1,185 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandlerHealthMonitor(t *testing.T) {
+
+	var failing, calls int32 = 1, 0
+	c := New(testkey)
+	c.Append("flaky", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			c.SetError(errors.New("flaky"))
+		}
+	}))
+	c.Append("h1", MakeHandler("h1"))
+	hm := NewHandlerHealthMonitor(c, 0.5, 4)
+	defer hm.Close()
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+		}
+	}
+
+	serve(4)
+	waitFor(t, func() bool { return hm.IsCircuitOpen("flaky") && c.IsDisabled("flaky") })
+
+	// Disabled handler is skipped and the chain succeeds.
+	serve(3)
+	if atomic.LoadInt32(&calls) != 4 || c.LastError() != nil {
+		t.Fatal("Disable() failed")
+	}
+	serve(1)
+	waitFor(t, func() bool { return !hm.IsCircuitOpen("flaky") && !c.IsDisabled("flaky") })
+
+	// Probation with failures above the recovery threshold disables again.
+	atomic.StoreInt32(&failing, 0)
+	serve(2)
+	atomic.StoreInt32(&failing, 1)
+	serve(2)
+	atomic.StoreInt32(&failing, 0)
+	waitFor(t, func() bool { return hm.IsCircuitOpen("flaky") })
+
+	// Healthy probation closes the circuit.
+	serve(4)
+	waitFor(t, func() bool { return !c.IsDisabled("flaky") })
+	serve(4)
+	time.Sleep(10 * time.Millisecond)
+	if hm.IsCircuitOpen("flaky") || c.IsDisabled("flaky") || atomic.LoadInt32(&calls) != 12 {
+		t.Fatal("HandlerHealthMonitor failed to recover")
+	}
+}
+
+func TestHandlerHealthMonitorReport(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("auth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.SetError(errors.New("unauthorized"))
+	}))
+	c.Append("validate", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	c.Append("h1", MakeHandler("h1"))
+	c.MarkBarrier("auth")
+	hm := NewHandlerHealthMonitor(c, 0.5, 2)
+	reported := make(chan string, 4)
+	hm.SetOnUnhealthy(func(name string, rate float64) {
+		if rate != 1 || !hm.IsUnhealthy(name) {
+			t.Error("SetOnUnhealthy() failed")
+		}
+		reported <- name
+	})
+	for i := 0; i < 2; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	select {
+	case name := <-reported:
+		if name != "auth" {
+			t.Fatal("SetOnUnhealthy() failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SetOnUnhealthy() failed")
+	}
+	// Barriers are reported but never disabled.
+	if c.IsDisabled("auth") || hm.IsCircuitOpen("auth") || !hm.IsUnhealthy("auth") {
+		t.Fatal("HandlerHealthMonitor disabled a barrier")
+	}
+
+	// Handlers opted out are reported only.
+	c2 := New(testkey)
+	c2.Append("flaky", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c2.SetError(errors.New("flaky"))
+	}))
+	hm2 := NewHandlerHealthMonitor(c2, 0.5, 2)
+	if err := hm2.ReportOnly("flaky", "nope"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("ReportOnly() failed")
+	}
+	hm2.ReportOnly("flaky")
+	for i := 0; i < 2; i++ {
+		c2.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	waitFor(t, func() bool { return hm2.IsUnhealthy("flaky") })
+	if c2.IsDisabled("flaky") || hm2.IsCircuitOpen("flaky") {
+		t.Fatal("HandlerHealthMonitor disabled a report only handler")
+	}
+
+	// Closed monitors are detached from the chain.
+	hm.Close()
+	hm2.Close()
+	if len(c.linkhooks) != 0 || len(c2.linkhooks) != 0 {
+		t.Fatal("Close() failed to remove hook")
+	}
+}
+
+func TestHandlerHealthMonitorDropped(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("flaky", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.SetError(errors.New("flaky"))
+	}))
+	hm := NewHandlerHealthMonitor(c, 0, 1)
+	defer hm.Close()
+	hm.ReportOnly("flaky")
+	block := make(chan struct{})
+	hm.SetOnUnhealthy(func(name string, rate float64) { <-block })
+
+	// A blocked monitor goroutine does not stall the chain.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < healthEventBuffer+2; i++ {
+			c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandlerHealthMonitor blocked the chain")
+	}
+	close(block)
+	if hm.Dropped() == 0 {
+		t.Fatal("Dropped() failed")
+	}
+}
+
+func TestDisable(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	if err := c.Disable("h3"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("Disable() failed")
+	}
+	c.Disable("h1")
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "Handler 'h2' reporting in.\n" {
+		t.Fatal("Disable() failed")
+	}
+	c.Enable("h1")
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "Handler 'h1' reporting in.\nHandler 'h2' reporting in.\n" {
+		t.Fatal("Enable() failed")
+	}
+}
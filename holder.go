@@ -0,0 +1,52 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// Holder is a http.Handler that delegates to a chain that can be
+// atomically replaced while serving requests.
+type Holder struct {
+	current atomic.Pointer[Chain]
+}
+
+// NewHolder returns a new Holder holding initial.
+func NewHolder(initial *Chain) *Holder {
+	p := &Holder{}
+	p.current.Store(initial)
+	return p
+}
+
+// ServeHTTP implements http.Handler by serving the request with the
+// current chain. Each request is served entirely by a single chain.
+func (h *Holder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.current.Load().ServeHTTP(w, r)
+}
+
+// Current returns the current chain.
+func (h *Holder) Current() *Chain { return h.current.Load() }
+
+// Swap atomically replaces the current chain with next and returns the
+// replaced chain. Requests being served by the replaced chain finish
+// normally.
+func (h *Holder) Swap(next *Chain) (old *Chain) {
+	return h.current.Swap(next)
+}
+
+// SwapClose replaces the current chain like Swap and closes the replaced
+// chain in the background once all requests it is serving finish.
+func (h *Holder) SwapClose(next *Chain) (old *Chain) {
+	old = h.Swap(next)
+	go func() {
+		old.Quiesce(context.Background())
+		old.Close()
+		old.Resume()
+	}()
+	return old
+}
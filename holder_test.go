@@ -0,0 +1,104 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func makeWriterChain(parts ...string) *Chain {
+	c := New(testkey)
+	for _, part := range parts {
+		part := part
+		c.Append(part, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(part))
+		}))
+	}
+	return c
+}
+
+func TestHolderSwap(t *testing.T) {
+
+	a, b := makeWriterChain("a1", "a2"), makeWriterChain("b1", "b2")
+	h := NewHolder(a)
+	if h.Current() != a {
+		t.Fatal("NewHolder() failed")
+	}
+
+	stop := make(chan struct{})
+	errs := make(chan string, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, MakeRequest("/"))
+				if body := rec.Body.String(); body != "a1a2" && body != "b1b2" {
+					errs <- body
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			h.Swap(b)
+		} else {
+			h.Swap(a)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for body := range errs {
+		t.Fatalf("Holder served torn response %q", body)
+	}
+}
+
+func TestHolderSwapClose(t *testing.T) {
+
+	registry := NewRegistry()
+	started, release := make(chan struct{}), make(chan struct{})
+	old := New(testkey)
+	old.Append("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	registry.RegisterChain("old", old)
+
+	h := NewHolder(old)
+	go h.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	<-started
+	if h.SwapClose(makeWriterChain("new")) != old {
+		t.Fatal("SwapClose() failed")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(registry.Chains()) != 1 {
+		t.Fatal("SwapClose() closed chain with requests in flight")
+	}
+	close(release)
+	for deadline := time.Now().Add(time.Second); len(registry.Chains()) != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("SwapClose() failed to close chain")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "new" {
+		t.Fatal("SwapClose() failed")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrUndeclaredJump is returned by MoveTo if the chain was created with
+// WithStrictJumps and the move was not declared with DeclareJumps.
+var ErrUndeclaredJump = ErrChainer.WrapFormat("undeclared jump from '%s' to '%s'")
+
+// WithStrictJumps makes MoveTo called by a handler reject moves to
+// handlers not declared for it with DeclareJumps with ErrUndeclaredJump.
+// Moves requested outside of handler execution are not affected.
+func WithStrictJumps() Option {
+	return func(c *Chain) { c.strictjumps = true }
+}
+
+// DeclareJumps declares names of handlers the handler registered under
+// from may move execution to using MoveTo. Declarations accumulate. If
+// from or any of targets is not registered ErrInvalidName sibling is
+// returned and no target is declared.
+//
+// Declared targets that are later removed or renamed are reported by
+// Lint. If the chain was created with WithStrictJumps, moves to targets
+// not declared for the executing handler are rejected.
+func (c *Chain) DeclareJumps(from string, targets ...string) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	key := c.normalize(from)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(from)
+	}
+	keys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		targetkey := c.normalize(target)
+		if _, exists := c.names[targetkey]; !exists {
+			return ErrInvalidName.WrapArgs(target)
+		}
+		keys = append(keys, targetkey)
+	}
+	if c.jumpdecl == nil {
+		c.jumpdecl = make(map[string]map[string]bool)
+	}
+	if c.jumpdecl[key] == nil {
+		c.jumpdecl[key] = make(map[string]bool)
+	}
+	for _, target := range keys {
+		c.jumpdecl[key][target] = true
+	}
+	return nil
+}
+
+// checkJump returns ErrUndeclaredJump sibling if strict jumps are enabled
+// and a move from the current handler to target was not declared.
+// varmu must be locked by the caller.
+func (c *Chain) checkJump(target string) error {
+	if !c.strictjumps || c.current == "" || c.jumpdecl[c.current][target] {
+		return nil
+	}
+	return ErrUndeclaredJump.WrapArgs(c.current, target)
+}
+
+// lintJumps returns issues for declared jumps whose handlers are no longer
+// registered or whose targets precede the declaring handler.
+// varmu must be locked by the caller.
+func (c *Chain) lintJumps(prefix string) (issues []LintIssue) {
+	froms := make([]string, 0, len(c.jumpdecl))
+	for from := range c.jumpdecl {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		path := prefix + c.spelling(from)
+		index, exists := c.names[from]
+		if !exists {
+			issues = append(issues, LintIssue{LintError, path,
+				"jumps declared for a handler that is not registered"})
+			continue
+		}
+		targets := make([]string, 0, len(c.jumpdecl[from]))
+		for target := range c.jumpdecl[from] {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		for _, target := range targets {
+			targetindex, exists := c.names[target]
+			if !exists {
+				issues = append(issues, LintIssue{LintError, path,
+					fmt.Sprintf("declared jump target '%s' is not registered", c.spelling(target))})
+				continue
+			}
+			if targetindex <= index {
+				issues = append(issues, LintIssue{LintWarning, path,
+					fmt.Sprintf("declared jump target '%s' points backwards and may loop", c.spelling(target))})
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeclareJumps(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	if err := c.DeclareJumps("h1", "h3", "h4"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("DeclareJumps() failed")
+	}
+	if err := c.DeclareJumps("h0", "h3"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("DeclareJumps() failed")
+	}
+	if err := c.DeclareJumps("h1", "h3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Lint()) != 0 {
+		t.Fatal("DeclareJumps() failed")
+	}
+
+	c.InjectBefore("h3", "h3renamed", func(h http.Handler) http.Handler { return h })
+	issues := c.Lint()
+	if len(issues) != 1 || issues[0].Severity != LintError || issues[0].Path != "h1" ||
+		!strings.Contains(issues[0].Message, "'h3'") {
+		t.Fatalf("Lint() failed to report renamed jump target: %v", issues)
+	}
+}
+
+func TestStrictJumps(t *testing.T) {
+
+	var moveErr error
+	mover := func(target string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain, _ := Unpack(r, testkey)
+			moveErr = chain.MoveTo(target)
+		})
+	}
+
+	c := New(testkey, WithStrictJumps())
+	c.Append("h1", mover("h3"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if !errors.Is(moveErr, ErrUndeclaredJump) || strings.Join(c.LastRun().Trace, ",") != "h1,h2,h3" {
+		t.Fatal("WithStrictJumps() failed to reject undeclared jump")
+	}
+
+	c.DeclareJumps("h1", "h3")
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if moveErr != nil || strings.Join(c.LastRun().Trace, ",") != "h1,h3" {
+		t.Fatal("WithStrictJumps() failed to allow declared jump")
+	}
+
+	if c.Clone().Lint() != nil || len(c.Clone().jumpdecl["h1"]) != 1 {
+		t.Fatal("Clone() failed to copy jump declarations")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"sync"
+)
+
+var (
+	// keymu guards keyring.
+	keymu sync.Mutex
+	// keyring holds keys registered with RegisterKey in registration order.
+	keyring []interface{}
+)
+
+// UnpackAny unpacks a chain from a request trying keys in specified order
+// and returns the first chain found, the key it was found under and a
+// truth if it exists, which if false, chain and key will be nil.
+func UnpackAny(r *http.Request, keys ...interface{}) (chain *Chain, key interface{}, exists bool) {
+	for _, key = range keys {
+		if chain, exists = Unpack(r, key); exists {
+			return
+		}
+	}
+	return nil, nil, false
+}
+
+// RegisterKey registers a chain key to be consulted by UnpackRegistered.
+// Registering an already registered key is a no-op.
+//
+// It allows handlers shared between applications whose chains use
+// different keys to find the chain executing them.
+func RegisterKey(key interface{}) {
+	keymu.Lock()
+	defer keymu.Unlock()
+
+	for _, k := range keyring {
+		if k == key {
+			return
+		}
+	}
+	keyring = append(keyring, key)
+}
+
+// UnpackRegistered unpacks a chain from a request using keys registered
+// with RegisterKey and returns the chain and a truth if it exists.
+//
+// If the innermost chain executing the request uses a registered key it
+// is returned, otherwise registered keys are tried in the order they were
+// registered.
+func UnpackRegistered(r *http.Request) (chain *Chain, exists bool) {
+	keymu.Lock()
+	keys := make([]interface{}, len(keyring))
+	copy(keys, keyring)
+	keymu.Unlock()
+
+	if inner, ok := FromContext(r.Context()); ok {
+		for _, key := range keys {
+			if inner.key == key {
+				return inner, true
+			}
+		}
+	}
+	chain, _, exists = UnpackAny(r, keys...)
+	return
+}
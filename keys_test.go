@@ -0,0 +1,102 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testKeyA struct{}
+type testKeyB struct{}
+type testKeyC struct{}
+
+func TestUnpackAny(t *testing.T) {
+
+	var result string
+	report := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, key, exists := UnpackAny(r, testKeyC{}, testKeyB{}, testKeyA{})
+		if !exists {
+			result = "none"
+			return
+		}
+		_, nested := chain.IndexOf("inner")
+		result = fmt.Sprintf("%T:%t", key, nested)
+	})
+
+	inner := New(testKeyA{})
+	inner.Append("inner", report)
+	outer := New(testKeyB{})
+	outer.Append("outer", report)
+	outer.Append("nested", inner)
+
+	outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "chainer.testKeyB:false" {
+		t.Fatalf("UnpackAny() failed: %s", result)
+	}
+
+	inner.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "chainer.testKeyA:true" {
+		t.Fatalf("UnpackAny() failed: %s", result)
+	}
+
+	if _, _, exists := UnpackAny(MakeRequest("/"), testKeyA{}); exists {
+		t.Fatal("UnpackAny() failed")
+	}
+}
+
+func TestUnpackRegistered(t *testing.T) {
+
+	var result string
+	report := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, exists := UnpackRegistered(r)
+		if !exists {
+			result = "none"
+			return
+		}
+		result = fmt.Sprintf("%T", chain.key)
+	})
+	nest := func(handler http.Handler, keys ...interface{}) *Chain {
+		var c *Chain
+		for i := len(keys) - 1; i >= 0; i-- {
+			c = New(keys[i])
+			c.Append("link", handler)
+			handler = c
+		}
+		return c
+	}
+
+	nest(report, testKeyB{}, testKeyA{}).ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "none" {
+		t.Fatalf("UnpackRegistered() failed: %s", result)
+	}
+
+	RegisterKey(testKeyB{})
+	RegisterKey(testKeyA{})
+	RegisterKey(testKeyB{})
+	defer func() {
+		keymu.Lock()
+		keyring = nil
+		keymu.Unlock()
+	}()
+
+	// Both registered keys are present, innermost chain wins.
+	nest(report, testKeyB{}, testKeyA{}).ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "chainer.testKeyA" {
+		t.Fatalf("UnpackRegistered() failed: %s", result)
+	}
+	nest(report, testKeyA{}, testKeyB{}).ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "chainer.testKeyB" {
+		t.Fatalf("UnpackRegistered() failed: %s", result)
+	}
+
+	// Innermost chain key is not registered, first registered key wins.
+	nest(report, testKeyA{}, testKeyB{}, testKeyC{}).ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if result != "chainer.testKeyB" {
+		t.Fatalf("UnpackRegistered() failed: %s", result)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"sync/atomic"
+)
+
+// ErrLateWrite is returned to handlers that write a response after the
+// chain stopped executing handlers because of an error or finished
+// serving the request if late write detection is enabled.
+var ErrLateWrite = ErrChainer.Wrap("write after chain stopped")
+
+// LateWriteReaction defines how a chain reacts to a write to the response
+// after it stopped executing handlers because of an error or finished
+// serving the request, for instance from a goroutine started by a
+// handler.
+type LateWriteReaction int
+
+const (
+	// LateWriteAllow disables late write detection and passes late writes
+	// through to the underlying http.ResponseWriter. This is the default.
+	LateWriteAllow LateWriteReaction = iota
+	// LateWriteIgnore discards late writes and counts them in
+	// ChainInfo.LateWrites.
+	LateWriteIgnore
+	// LateWriteLog discards and counts late writes like LateWriteIgnore
+	// and logs them to the chain run logger or slog.Default.
+	LateWriteLog
+	// LateWritePanic counts late writes and panics with ErrLateWrite from
+	// the writing goroutine.
+	LateWritePanic
+)
+
+// WithLateWrite enables detection of writes to the response after the
+// chain finished serving the request or, once the handler that set the
+// chain error or aborted the run returns, after the chain stopped
+// executing handlers, with the specified reaction. Writes of the error
+// handler and post-run handlers dispatching the result of the run are
+// not affected. Detected late writes are discarded and return
+// ErrLateWrite.
+func WithLateWrite(reaction LateWriteReaction) Option {
+	return func(c *Chain) { c.latewrite = reaction }
+}
+
+// lateWrite reacts to a late write as configured.
+func (c *Chain) lateWrite() error {
+	atomic.AddUint64(&c.latewrs, 1)
+	switch c.latewrite {
+	case LateWriteLog:
+		c.logger().Warn(ErrLateWrite.Error())
+	case LateWritePanic:
+		panic(ErrLateWrite)
+	}
+	return ErrLateWrite
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func makeLateWriteChain(options ...Option) (*Chain, func() http.ResponseWriter) {
+	var late http.ResponseWriter
+	c := New(testkey, options...)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		late = w
+	}))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	return c, func() http.ResponseWriter { return late }
+}
+
+func TestLateWrite(t *testing.T) {
+
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+
+	for _, reaction := range []LateWriteReaction{LateWriteAllow, LateWriteIgnore, LateWriteLog, LateWritePanic} {
+		c, late := makeLateWriteChain(WithLateWrite(reaction), WithRunLogger(logger, nil))
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, MakeRequest("/"))
+		body := rec.Body.String()
+
+		var recovered interface{}
+		var err error
+		func() {
+			defer func() { recovered = recover() }()
+			_, err = late().Write([]byte("late"))
+		}()
+
+		switch reaction {
+		case LateWriteAllow:
+			if err != nil || rec.Body.String() != body+"late" {
+				t.Fatal("LateWriteAllow failed")
+			}
+			continue
+		case LateWriteIgnore:
+			if !errors.Is(err, ErrLateWrite) {
+				t.Fatal("LateWriteIgnore failed")
+			}
+		case LateWriteLog:
+			if !errors.Is(err, ErrLateWrite) || !strings.Contains(buf.String(), "write after chain stopped") {
+				t.Fatal("LateWriteLog failed")
+			}
+		case LateWritePanic:
+			if recovered != ErrLateWrite {
+				t.Fatal("LateWritePanic failed")
+			}
+		}
+		if rec.Body.String() != body || c.info("").LateWrites != 1 {
+			t.Fatal("WithLateWrite() failed")
+		}
+	}
+}
+
+func TestLateWriteAfterError(t *testing.T) {
+
+	c, late := makeLateWriteChain(WithLateWrite(LateWriteIgnore))
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		if _, err := w.Write([]byte("error;")); err != nil {
+			t.Fatal("WithLateWrite() failed error handler")
+		}
+	})
+	var lateErr error
+	c.DeferHandler("deferred", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, lateErr = late().Write([]byte("late;"))
+		if _, err := w.Write([]byte("deferred;")); err != nil {
+			t.Fatal("WithLateWrite() failed post-run handler")
+		}
+	}))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if !errors.Is(lateErr, ErrLateWrite) || c.info("").LateWrites != 1 {
+		t.Fatal("WithLateWrite() failed to detect write after error")
+	}
+	if body := rec.Body.String(); strings.Contains(body, "late;") || !strings.HasSuffix(body, "deferred;") {
+		t.Fatal("WithLateWrite() failed")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ErrDupHandler is returned by Validate if the same handler instance is
+// registered under multiple names.
+var ErrDupHandler = ErrChainer.WrapFormat("same handler registered under multiple names: %s")
+
+// Validate returns ErrDupHandler sibling listing offending names if the
+// same handler instance is registered in the chain under more than one
+// name. Handlers without a comparable identity, such as functions, are not
+// checked. Validate shares the lock with ServeHTTP.
+func (c *Chain) Validate() error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	dups := duplicateHandlers(c.links, c.indexes)
+	if len(dups) == 0 {
+		return nil
+	}
+	groups := make([]string, 0, len(dups))
+	for _, names := range dups {
+		groups = append(groups, "'"+strings.Join(names, "', '")+"'")
+	}
+	return ErrDupHandler.WrapArgs(strings.Join(groups, "; "))
+}
+
+// LintSeverity is the severity of a LintIssue.
+type LintSeverity int
+
+const (
+	// LintInfo marks an issue that is most likely intentional.
+	LintInfo LintSeverity = iota
+	// LintWarning marks an issue that is likely a mistake.
+	LintWarning
+	// LintError marks an issue that is certainly a mistake.
+	LintError
+)
+
+// String implements fmt.Stringer.
+func (ls LintSeverity) String() string {
+	switch ls {
+	case LintInfo:
+		return "info"
+	case LintWarning:
+		return "warning"
+	case LintError:
+		return "error"
+	}
+	return fmt.Sprintf("LintSeverity(%d)", int(ls))
+}
+
+// LintIssue is an issue found by Lint.
+type LintIssue struct {
+	// Severity is the issue severity.
+	Severity LintSeverity
+	// Path is the slash separated path of handler names from the linted
+	// chain to the offending handler.
+	Path string
+	// Message describes the issue.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", li.Severity, li.Path, li.Message)
+}
+
+// MarkTerminal marks a handler registered under name as terminal, i.e. a
+// handler after which chain execution never continues, for Lint.
+// If name is not registered ErrInvalidName sibling is returned.
+func (c *Chain) MarkTerminal(name string) error {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return ErrInvalidName.WrapArgs(name)
+	}
+	c.marks[key] = true
+	return nil
+}
+
+// Lint statically analyzes the chain and nested chains and returns found
+// issues, if any. It reports:
+//
+//   - handlers following a handler marked with MarkTerminal that are not
+//     made reachable by an entry point set with SetEntryPoint,
+//   - handler instances registered under more than one name,
+//   - empty nested chains,
+//   - chains nested in themselves, directly or through other chains,
+//   - jumps declared with DeclareJumps for handlers that are no longer
+//     registered,
+//   - jumps declared with DeclareJumps to the declaring handler or a
+//     handler preceding it, which may loop.
+//
+// Nested chains, including chains appended with AppendPrefix, are linted
+// recursively. Handlers are reported under the names they were registered
+// with.
+//
+// Lint shares the lock with ServeHTTP.
+func (c *Chain) Lint() []LintIssue {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	return c.lint("", map[*Chain]bool{c: true})
+}
+
+// lint returns issues of c prefixing handler paths with prefix. active
+// are chains being linted, c and its ancestors, whose runmu is locked.
+// runmu must be locked by the caller.
+func (c *Chain) lint(prefix string, active map[*Chain]bool) (issues []LintIssue) {
+	c.varmu.Lock()
+	names := make([]string, len(c.indexes))
+	for i, key := range c.indexes {
+		names[i] = c.spelling(key)
+	}
+	c.varmu.Unlock()
+
+	entries := make(map[string]bool)
+	for _, key := range c.entries {
+		entries[key] = true
+	}
+	terminal := ""
+	for i, link := range c.links {
+		if i >= len(c.indexes) {
+			break
+		}
+		key, name := c.indexes[i], names[i]
+		if entries[key] {
+			terminal = ""
+		}
+		if terminal != "" {
+			issues = append(issues, LintIssue{LintError, prefix + name,
+				fmt.Sprintf("unreachable, follows terminal handler '%s'", terminal)})
+		}
+		if c.marks[key] {
+			terminal = name
+		}
+		var nested *Chain
+		switch handler := link.(type) {
+		case *Chain:
+			nested = handler
+		case *prefixHandler:
+			nested = handler.chain
+		default:
+			continue
+		}
+		if active[nested] {
+			issues = append(issues, LintIssue{LintError, prefix + name, "chain nested in itself"})
+			continue
+		}
+		nested.runmu.Lock()
+		if len(nested.links) == 0 {
+			issues = append(issues, LintIssue{LintWarning, prefix + name, "empty nested chain"})
+		}
+		active[nested] = true
+		issues = append(issues, nested.lint(prefix+name+"/", active)...)
+		delete(active, nested)
+		nested.runmu.Unlock()
+	}
+	for _, group := range duplicateHandlers(c.links, names) {
+		issues = append(issues, LintIssue{LintWarning, prefix + group[0],
+			fmt.Sprintf("same handler also registered as '%s'", strings.Join(group[1:], "', '"))})
+	}
+	c.varmu.Lock()
+	issues = append(issues, c.lintJumps(prefix)...)
+	c.varmu.Unlock()
+	return
+}
+
+// handlerIdentity returns a value identifying a handler instance and true
+// or nil and false if the handler has no identity that can be compared,
+// such as functions.
+func handlerIdentity(h http.Handler) (interface{}, bool) {
+	v := reflect.ValueOf(h)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return v.Pointer(), true
+	case reflect.Func, reflect.Map, reflect.Slice, reflect.Invalid:
+		return nil, false
+	}
+	if !v.Type().Comparable() {
+		return nil, false
+	}
+	return h, true
+}
+
+// duplicateHandlers returns groups of names under which the same handler
+// instance is registered, in order of registration.
+func duplicateHandlers(links []http.Handler, names []string) (dups [][]string) {
+	seen := make(map[interface{}]int)
+	for i, link := range links {
+		if i >= len(names) {
+			break
+		}
+		id, ok := handlerIdentity(link)
+		if !ok {
+			continue
+		}
+		if group, exists := seen[id]; exists {
+			dups[group] = append(dups[group], names[i])
+			continue
+		}
+		seen[id] = len(dups)
+		dups = append(dups, []string{names[i]})
+	}
+	r := dups[:0]
+	for _, group := range dups {
+		if len(group) > 1 {
+			r = append(r, group)
+		}
+	}
+	return r
+}
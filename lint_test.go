@@ -0,0 +1,143 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLint(t *testing.T) {
+
+	shared := newTestHandler("shared")
+	c := New(testkey)
+	c.Append("h1", shared)
+	c.Append("h2", shared)
+	c.Append("terminal", MakeHandler("terminal"))
+	c.Append("unreachable", MakeHandler("unreachable"))
+	c.Append("entry", MakeHandler("entry"))
+	nested := New(testkey)
+	nested.Append("empty", New(testkey))
+	c.Append("nested", nested)
+
+	if err := c.MarkTerminal("none"); !errors.Is(err, ErrInvalidName) {
+		t.Fatal("MarkTerminal() failed")
+	}
+	if err := c.MarkTerminal("terminal"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Lint()) != 5 {
+		t.Fatal("Lint() failed")
+	}
+	c.SetEntryPoint("/entry", "entry")
+
+	want := []LintIssue{
+		{LintError, "unreachable", "unreachable, follows terminal handler 'terminal'"},
+		{LintWarning, "nested/empty", "empty nested chain"},
+		{LintWarning, "h1", "same handler also registered as 'h2'"},
+	}
+	issues := c.Lint()
+	if len(issues) != len(want) {
+		t.Fatalf("Lint() failed: %v", issues)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Fatalf("Lint() failed: got %v, want %v", issues[i], want[i])
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	shared := newTestHandler("shared")
+	c := New(testkey)
+	c.Append("h1", shared)
+	c.Append("h2", MakeHandler("h2"))
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c.Append("h3", shared)
+	err := c.Validate()
+	if !errors.Is(err, ErrDupHandler) || !strings.Contains(err.Error(), "'h1', 'h3'") {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+}
+
+// cyclicChains returns a chain nested in itself and a chain nested in a
+// chain nested in it.
+func cyclicChains() (self, mutual *Chain) {
+	self = New(testkey)
+	self.Append("h1", MakeHandler("h1"))
+	self.Append("self", self)
+	mutual, other := New(testkey), New(testkey)
+	mutual.Append("other", other)
+	other.Append("mutual", mutual)
+	return
+}
+
+// within fails t if fn does not return within a second.
+func within(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlock")
+	}
+}
+
+func TestLintCycle(t *testing.T) {
+
+	self, mutual := cyclicChains()
+	var selfIssues, mutualIssues []LintIssue
+	within(t, func() {
+		selfIssues = self.Lint()
+		mutualIssues = mutual.Lint()
+	})
+	if len(selfIssues) != 1 || selfIssues[0].Severity != LintError || selfIssues[0].Path != "self" {
+		t.Fatal("Lint() failed to report cycle")
+	}
+	if len(mutualIssues) != 1 || mutualIssues[0].Path != "other/mutual" {
+		t.Fatal("Lint() failed to report cycle")
+	}
+}
+
+func TestLintJumpsAndPrefix(t *testing.T) {
+
+	c := New(testkey, WithNameNormalizer(FoldNames))
+	c.Append("Auth", MakeHandler("Auth"))
+	c.Append("Retry", MakeHandler("Retry"))
+	c.Append("Final", MakeHandler("Final"))
+	c.Append("Unreachable", MakeHandler("Unreachable"))
+	sub := New(testkey)
+	sub.Append("Empty", New(testkey))
+	c.AppendPrefix("/api", sub)
+	c.MarkTerminal("final")
+	c.DeclareJumps("retry", "auth", "final")
+	c.DeclareJumps("final", "final")
+
+	want := []LintIssue{
+		{LintError, "Unreachable", "unreachable, follows terminal handler 'Final'"},
+		{LintError, "/api", "unreachable, follows terminal handler 'Final'"},
+		{LintWarning, "/api/Empty", "empty nested chain"},
+		{LintWarning, "Final", "declared jump target 'Final' points backwards and may loop"},
+		{LintWarning, "Retry", "declared jump target 'Auth' points backwards and may loop"},
+	}
+	issues := c.Lint()
+	if len(issues) != len(want) {
+		t.Fatalf("Lint() failed: %v", issues)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Fatalf("Lint() failed: got %v, want %v", issues[i], want[i])
+		}
+	}
+}
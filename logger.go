@@ -0,0 +1,98 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// loggerKey is the context key of the run logger.
+type loggerKey struct{}
+
+// WithRunLogger makes the chain derive a logger from base for every
+// request it serves, enriched with attributes returned by enrich, which
+// may be nil. Handlers retrieve it using LoggerFrom.
+//
+// If the request already carries a run logger, for instance when the
+// chain is nested in a chain with a run logger, that logger is reused.
+func WithRunLogger(base *slog.Logger, enrich func(*http.Request, *Chain) []slog.Attr) Option {
+	return func(c *Chain) {
+		c.runlogger = base
+		c.enrichlog = enrich
+	}
+}
+
+// LoggerFrom returns the run logger from the context of a request served
+// by a chain with a run logger or slog.Default if none.
+func LoggerFrom(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withRunLogger returns ctx with a run logger derived for r if the chain
+// has a run logger and ctx does not already carry one.
+func (c *Chain) withRunLogger(ctx context.Context, r *http.Request) context.Context {
+	if c.runlogger == nil {
+		return ctx
+	}
+	if _, exists := ctx.Value(loggerKey{}).(*slog.Logger); exists {
+		return ctx
+	}
+	logger := c.runlogger
+	if c.enrichlog != nil {
+		attrs := c.enrichlog(r, c)
+		args := make([]interface{}, 0, len(attrs))
+		for _, attr := range attrs {
+			args = append(args, attr)
+		}
+		logger = logger.With(args...)
+	}
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// logger returns the chain run logger or slog.Default if none.
+func (c *Chain) logger() *slog.Logger {
+	if c.runlogger != nil {
+		return c.runlogger
+	}
+	return slog.Default()
+}
+
+// Logger is a minimal logger interface satisfied by *log.Logger,
+// *testing.T and many other loggers.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// DiagSlowHandler is the handler execution time, as measured by the chain
+// clock, above which a chain with a diagnostic logger logs a warning.
+const DiagSlowHandler = time.Second
+
+// DiagLoopFactor is the multiple of the number of handlers in a chain
+// above which the number of handler executions in a single run makes a
+// chain with a diagnostic logger log a warning about a possible MoveTo
+// loop. The warning is logged once per run.
+const DiagLoopFactor = 10
+
+// WithLogger sets a logger to which the chain logs internal diagnostic
+// warnings while serving requests: handlers executing longer than
+// DiagSlowHandler, runs executing more handlers than DiagLoopFactor times
+// the number of handlers, runs rejected by WithMaxDepth and calls to
+// InitVars after the chain started serving.
+func WithLogger(logger Logger) Option {
+	return func(c *Chain) { c.diaglog = logger }
+}
+
+// diagf logs a diagnostic message if the chain has a diagnostic logger.
+func (c *Chain) diagf(format string, v ...interface{}) {
+	if c.diaglog != nil {
+		c.diaglog.Printf("chainer: "+format, v...)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunLogger(t *testing.T) {
+
+	buf := bytes.NewBuffer(nil)
+	enrich := func(r *http.Request, c *Chain) []slog.Attr {
+		return []slog.Attr{slog.String("request_id", r.Header.Get("X-Request-ID"))}
+	}
+
+	inner := New(testkey, WithRunLogger(slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil)), enrich))
+	inner.Append("logger", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r).Info("hello")
+	}))
+	middle := New(testkey)
+	middle.Append("inner", inner)
+	outer := New(testkey, WithRunLogger(slog.New(slog.NewTextHandler(buf, nil)), enrich))
+	outer.Append("middle", middle)
+
+	req := MakeRequest("/")
+	req.Header.Set("X-Request-ID", "abc123")
+	outer.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	if !strings.Contains(out, "msg=hello") || strings.Count(out, "request_id=abc123") != 1 {
+		t.Fatalf("TestRunLogger() failed: %s", out)
+	}
+
+	if LoggerFrom(MakeRequest("/")) != slog.Default() {
+		t.Fatal("LoggerFrom() failed")
+	}
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (tl *testLogger) Printf(format string, v ...interface{}) {
+	tl.lines = append(tl.lines, fmt.Sprintf(format, v...))
+}
+
+func TestWithLogger(t *testing.T) {
+
+	logger := &testLogger{}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := New(testkey, WithLogger(logger), WithClock(clock.Now))
+	c.Append("slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(2 * DiagSlowHandler)
+	}))
+	c.Append("fast", MakeHandler("fast"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "handler 'slow' executed in 2s") {
+		t.Fatalf("WithLogger() failed: %v", logger.lines)
+	}
+
+	logger = &testLogger{}
+	count := 0
+	c = New(testkey, WithLogger(logger))
+	c.Append("loop", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count++; count < 3*DiagLoopFactor {
+			chain, _ := Unpack(r, testkey)
+			chain.MoveTo("loop")
+		}
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "possible MoveTo loop") {
+		t.Fatalf("WithLogger() failed: %v", logger.lines)
+	}
+
+	logger = &testLogger{}
+	inner := New(testkey, WithLogger(logger), WithMaxDepth(1))
+	outer := New(testkey)
+	outer.Append("inner", inner)
+	inner.Append("h1", MakeHandler("h1"))
+	outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(logger.lines) != 0 {
+		t.Fatalf("WithLogger() failed: %v", logger.lines)
+	}
+	middle := New(testkey)
+	middle.Append("inner", inner)
+	outer = New(testkey, WithMaxDepth(2))
+	outer.Append("middle", middle)
+	outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "maximum nesting depth exceeded") {
+		t.Fatalf("WithLogger() failed: %v", logger.lines)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"time"
+)
+
+// Metrics receives chain metrics, for instance to export them to a
+// metrics system such as Prometheus without a dependency of this package
+// on it. Methods are called synchronously from the goroutine serving the
+// request and must be safe for concurrent use if the Metrics is shared.
+type Metrics interface {
+	// ObserveDuration is called with the name and execution time of each
+	// executed handler.
+	ObserveDuration(name string, d time.Duration)
+	// IncError is called with the name of a handler that set an error.
+	IncError(name string)
+	// IncRequest is called once for each request served by the chain.
+	IncRequest()
+}
+
+// SetMetrics sets the Metrics the chain reports to. A nil m disables
+// metrics.
+func (c *Chain) SetMetrics(m Metrics) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.metrics = m
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	requests  int
+	durations []string
+	errors    []string
+}
+
+func (tm *testMetrics) ObserveDuration(name string, d time.Duration) {
+	tm.durations = append(tm.durations, name)
+}
+
+func (tm *testMetrics) IncError(name string) { tm.errors = append(tm.errors, name) }
+
+func (tm *testMetrics) IncRequest() { tm.requests++ }
+
+func TestSetMetrics(t *testing.T) {
+
+	tm := &testMetrics{}
+	c := New(testkey)
+	c.SetMetrics(tm)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	c.SetEntryPoint("/three", "h3")
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/three"))
+
+	if tm.requests != 2 || strings.Join(tm.durations, ",") != "h1,h2,h3" || strings.Join(tm.errors, ",") != "h2" {
+		t.Fatalf("SetMetrics() failed: %+v", tm)
+	}
+
+	c.SetMetrics(nil)
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if tm.requests != 2 {
+		t.Fatal("SetMetrics() failed")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+)
+
+// ChainMiddleware is a http.Handler that executes a Chain wrapped in
+// traditional func(http.Handler) http.Handler middleware.
+type ChainMiddleware struct {
+	chain   *Chain
+	handler http.Handler
+}
+
+// NewChainMiddleware returns a new ChainMiddleware that executes c as the
+// innermost handler wrapped in mw. The first middleware is the outermost
+// one, i.e. a request passes through mw in specified order before
+// reaching c.
+func NewChainMiddleware(c *Chain, mw ...func(http.Handler) http.Handler) *ChainMiddleware {
+	var handler http.Handler = c
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+	return &ChainMiddleware{chain: c, handler: handler}
+}
+
+// Chain returns the chain executed by cm.
+func (cm *ChainMiddleware) Chain() *Chain { return cm.chain }
+
+// ServeHTTP implements http.Handler.
+func (cm *ChainMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cm.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func MakeMiddleware(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "Middleware '%s' before.\n", name)
+			next.ServeHTTP(w, r)
+			fmt.Fprintf(w, "Middleware '%s' after.\n", name)
+		})
+	}
+}
+
+func TestChainMiddleware(t *testing.T) {
+
+	const want = `Middleware 'm1' before.
+Middleware 'm2' before.
+Handler 'h1' reporting in.
+Handler 'h2' reporting in.
+Middleware 'm2' after.
+Middleware 'm1' after.
+`
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	cm := NewChainMiddleware(c, MakeMiddleware("m1"), MakeMiddleware("m2"))
+	if cm.Chain() != c {
+		t.Fatal("Chain() failed")
+	}
+
+	rec := httptest.NewRecorder()
+	cm.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want {
+		t.Fatal("ChainMiddleware failed")
+	}
+
+	// ChainMiddleware can itself be a link of a chain.
+	outer := New(testkey)
+	outer.Append("wrapped", NewChainMiddleware(c))
+	rec = httptest.NewRecorder()
+	outer.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != "Handler 'h1' reporting in.\nHandler 'h2' reporting in.\n" {
+		t.Fatal("ChainMiddleware failed")
+	}
+}
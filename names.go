@@ -0,0 +1,73 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// WithNameNormalizer makes the chain normalize handler names with fn
+// when registering handlers and when looking them up by name, for
+// instance in Append, MoveTo, IndexOf, Override and SetEntryPoint.
+// Handlers are registered and reported by Names under normalized names.
+//
+// If two different names normalize to the same name, registering the
+// second one returns ErrNameCollision sibling naming both spellings.
+// Names of handlers registered with OnSuccess, OnFailure and DeferHandler
+// are not normalized.
+func WithNameNormalizer(fn func(string) string) Option {
+	return func(c *Chain) { c.namenorm = fn }
+}
+
+// FoldNames is a name normalizer for WithNameNormalizer that trims
+// leading and trailing white space and applies Unicode simple case
+// folding so that names that differ only in case are equal.
+func FoldNames(name string) string {
+	return strings.Map(foldRune, strings.TrimSpace(name))
+}
+
+// foldRune returns the lower case form of the smallest rune in the case
+// folding orbit of r so that all runes of an orbit map to the same rune.
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
+// normalize returns name normalized by the chain name normalizer.
+func (c *Chain) normalize(name string) string {
+	if c.namenorm == nil {
+		return name
+	}
+	return c.namenorm(name)
+}
+
+// spelling returns the name key was registered under or key if it is no
+// longer registered. varmu must be locked by the caller.
+func (c *Chain) spelling(key string) string {
+	if name, exists := c.spells[key]; exists {
+		return name
+	}
+	return key
+}
+
+// checkName returns the normalized name under which a handler with name
+// would be registered or an error if name is already registered.
+// runmu must be locked by the caller.
+func (c *Chain) checkName(name string) (string, error) {
+	key := c.normalize(name)
+	if _, exists := c.names[key]; !exists {
+		return key, nil
+	}
+	if spelling := c.spells[key]; spelling != name {
+		return "", c.strictErr(ErrNameCollision.WrapArgs(name, spelling))
+	}
+	return "", c.strictErr(ErrDupName.WrapArgs(name))
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFoldNames(t *testing.T) {
+
+	for _, name := range []string{"auth", "Auth", " AUTH\t"} {
+		if FoldNames(name) != "auth" {
+			t.Fatalf("FoldNames() failed: %q", FoldNames(name))
+		}
+	}
+	// KELVIN SIGN folds with k and K.
+	if FoldNames("\u212Aey") != "key" {
+		t.Fatal("FoldNames() failed")
+	}
+}
+
+func TestNameNormalizer(t *testing.T) {
+
+	const want = "Handler 'Auth' reporting in.\nHandler 'Final' reporting in.\n"
+	c := New(testkey, WithNameNormalizer(FoldNames))
+	c.Append("Auth", MakeHandler("Auth"))
+	c.Append("Skipped", MakeHandler("Skipped"))
+	c.Append("Final", MakeHandler("Final"))
+	c.Override("AUTH", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		MakeHandler("Auth").ServeHTTP(w, r)
+		if err := c.MoveTo(" FINAL "); err != nil {
+			t.Fatal("MoveTo() failed")
+		}
+	}))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.String() != want {
+		t.Fatal("MoveTo() failed")
+	}
+	if i, ok := c.IndexOf("skipped"); !ok || i != 1 {
+		t.Fatal("IndexOf() failed")
+	}
+	if strings.Join(c.Names(), ",") != "auth,skipped,final" {
+		t.Fatal("Names() failed")
+	}
+
+	err := c.Append("AUTH", MakeHandler("AUTH"))
+	if !errors.Is(err, ErrNameCollision) || !strings.Contains(err.Error(), "'AUTH' collides with registered name 'Auth'") {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	if err := c.Append("Auth", MakeHandler("Auth")); !errors.Is(err, ErrDupName) {
+		t.Fatal("Append() failed")
+	}
+	clone := c.Clone()
+	if err := clone.Append("auth", MakeHandler("auth")); !errors.Is(err, ErrNameCollision) {
+		t.Fatal("Clone() failed")
+	}
+}
+
+func TestNameNormalizerAppendMethod(t *testing.T) {
+
+	c := New(testkey, WithNameNormalizer(FoldNames))
+	c.AppendMethod("POST", "Create", MakeHandler("Create"))
+	c.Append("Other", MakeHandler("Other"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "Handler 'Create' reporting in.\nHandler 'Other' reporting in.\n" {
+		t.Fatalf("AppendMethod() failed: %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Fatalf("AppendMethod() failed: %d %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if d := c.Describe(); d.Handlers[0].Method != "POST" {
+		t.Fatal("Describe() failed")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"time"
+)
+
+// Observer observes chain execution.
+//
+// Observer methods are called synchronously from the goroutine serving
+// the request and should return quickly.
+type Observer interface {
+	// Start is called before a handler registered under name is executed
+	// for request r.
+	Start(name string, r *http.Request)
+	// End is called after a handler registered under name was executed
+	// with the duration of its execution and LastError after it returned.
+	End(name string, dur time.Duration, err error)
+	// Complete is called once a run, including post-run handlers, finished
+	// with names of executed handlers in order of execution and LastError.
+	Complete(visited []string, err error)
+}
+
+// NopObserver is an Observer that does nothing. It is the default
+// observer of a chain.
+type NopObserver struct{}
+
+// Start implements Observer.Start.
+func (NopObserver) Start(name string, r *http.Request) {}
+
+// End implements Observer.End.
+func (NopObserver) End(name string, dur time.Duration, err error) {}
+
+// Complete implements Observer.Complete.
+func (NopObserver) Complete(visited []string, err error) {}
+
+// WithObserver sets an Observer of chain execution. A nil obs sets
+// NopObserver.
+func WithObserver(obs Observer) Option {
+	if obs == nil {
+		obs = NopObserver{}
+	}
+	return func(c *Chain) { c.observer = obs }
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testObserver struct {
+	events []string
+}
+
+func (to *testObserver) Start(name string, r *http.Request) {
+	to.events = append(to.events, "start "+name+" "+r.URL.Path)
+}
+
+func (to *testObserver) End(name string, dur time.Duration, err error) {
+	to.events = append(to.events, fmt.Sprintf("end %s %v", name, err != nil))
+}
+
+func (to *testObserver) Complete(visited []string, err error) {
+	to.events = append(to.events, fmt.Sprintf("complete %s %v", strings.Join(visited, ","), err != nil))
+}
+
+func TestObserver(t *testing.T) {
+
+	const want = "start h1 /,end h1 false,start h2 /,end h2 true,complete h1,h2 true"
+	obs := &testObserver{}
+	c := New(testkey, WithObserver(obs))
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if strings.Join(obs.events, ",") != want {
+		t.Fatalf("WithObserver() failed: %v", obs.events)
+	}
+
+	c = New(testkey, WithObserver(nil))
+	c.Append("h1", MakeHandler("h1"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// ChainPanicInfo describes where a panic in a chain occurred.
+type ChainPanicInfo struct {
+	// Chain is the innermost chain in which the panic occurred.
+	Chain *Chain
+	// Link is the name of the handler that panicked.
+	Link string
+	// Path is the slash separated path of handler names from the
+	// outermost chain to the handler that panicked.
+	Path string
+	// Index is the position of the handler in Chain.
+	Index int
+	// Executed is the number of handlers Chain executed in the run,
+	// including the one that panicked.
+	Executed int
+	// Method is the request method.
+	Method string
+	// URL is the request URL path.
+	URL string
+	// Value is the original value passed to panic.
+	Value interface{}
+}
+
+// chainPanic is the value a chain re-panics with when a handler panics.
+type chainPanic struct {
+	info ChainPanicInfo
+}
+
+// Error implements error so that the panic is reported legibly.
+func (cp *chainPanic) Error() string {
+	return fmt.Sprintf("chainer: panic in handler '%s' serving %s %s: %v",
+		cp.info.Path, cp.info.Method, cp.info.URL, cp.info.Value)
+}
+
+// Unwrap returns the original panic value if it is an error.
+func (cp *chainPanic) Unwrap() error {
+	err, _ := cp.info.Value.(error)
+	return err
+}
+
+// PanicInfo returns the ChainPanicInfo attached to a value recovered from
+// a panic that occurred in a chain handler and true or an empty
+// ChainPanicInfo and false if recovered does not originate from a chain.
+//
+// Chains re-panic with a value carrying ChainPanicInfo whenever a handler
+// panics, except for http.ErrAbortHandler which is passed through, unless
+// created with WithRecoveryFunc.
+// If the request carries a run logger, an error record is logged before
+// re-panicking.
+func PanicInfo(recovered interface{}) (ChainPanicInfo, bool) {
+	if cp, ok := recovered.(*chainPanic); ok {
+		return cp.info, true
+	}
+	return ChainPanicInfo{}, false
+}
+
+// WithRecoveryFunc makes the chain recover from panics of its handlers,
+// including panics propagated from nested chains, instead of propagating
+// them. The recovered value, annotated as described by PanicInfo, is
+// passed to fn. It implements error and unwraps to the original value if
+// that is an error, so fn may return it as is or convert it to an error
+// of its own. The returned error is set as the chain error as by SetError.
+//
+// If fn returns nil the panic is suppressed entirely: no error is set and
+// the chain continues with the next handler as if the panicking handler
+// returned normally. Use with care, the panicking handler may have left
+// the response or shared state partially written.
+//
+// http.ErrAbortHandler is never recovered.
+func WithRecoveryFunc(fn func(recovered interface{}) error) Option {
+	return func(c *Chain) { c.recoverfn = fn }
+}
+
+// SetOnHandlerPanic sets a function called with the name of the handler,
+// the value recovered from the panic and the stack trace of the panicking
+// goroutine when a handler executing in the chain panics, before the
+// panic is propagated as described by PanicInfo. It is called only by the
+// chain in which the panic occurred and not for http.ErrAbortHandler.
+// fn must not call chain methods that share the lock with ServeHTTP.
+// A nil fn removes the function.
+func (c *Chain) SetOnHandlerPanic(fn func(name string, recovered interface{}, stack []byte)) {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.onpanic = fn
+}
+
+// invoke executes link at index i, propagating errors of nested chains
+// and annotating panics.
+func (c *Chain) invoke(i int, link http.Handler, w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if v := recover(); v != nil {
+			v = c.annotatePanic(v, i, r)
+			if c.recoverfn == nil || v == http.ErrAbortHandler {
+				panic(v)
+			}
+			if err := c.recoverfn(v); err != nil {
+				c.SetError(err)
+			}
+		}
+	}()
+	if chain, ok := link.(*Chain); ok {
+		c.SetError(chain.serve(nil, time.Time{}, w, r).err)
+		return
+	}
+	link.ServeHTTP(w, r)
+}
+
+// annotatePanic returns v annotated with ChainPanicInfo for link at index i.
+func (c *Chain) annotatePanic(v interface{}, i int, r *http.Request) interface{} {
+	if v == http.ErrAbortHandler {
+		return v
+	}
+	name := ""
+	if i < len(c.indexes) {
+		name = c.indexes[i]
+	}
+	if cp, ok := v.(*chainPanic); ok {
+		cp.info.Path = name + "/" + cp.info.Path
+		return cp
+	}
+	if c.onpanic != nil {
+		c.onpanic(name, v, debug.Stack())
+	}
+	executed := c.executed
+	cp := &chainPanic{ChainPanicInfo{
+		Chain:    c,
+		Link:     name,
+		Path:     name,
+		Index:    i,
+		Executed: executed,
+		Method:   r.Method,
+		URL:      r.URL.Path,
+		Value:    v,
+	}}
+	if logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		logger.Error("handler panicked",
+			slog.String("link", name),
+			slog.Int("index", i),
+			slog.Int("executed", executed),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Any("value", v))
+	}
+	return cp
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPanicInfo(t *testing.T) {
+
+	buf := bytes.NewBuffer(nil)
+	inner := New(testkey)
+	inner.Append("inner h1", MakeHandler("inner h1"))
+	inner.Append("panicker", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	outer := New(testkey, WithRunLogger(slog.New(slog.NewTextHandler(buf, nil)), nil))
+	outer.Append("h1", MakeHandler("h1"))
+	outer.Append("nested", inner)
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/panic"))
+	}()
+
+	info, ok := PanicInfo(recovered)
+	if !ok {
+		t.Fatalf("PanicInfo() failed: %v", recovered)
+	}
+	if info.Chain != inner || info.Link != "panicker" || info.Path != "nested/panicker" ||
+		info.Index != 1 || info.Executed != 2 || info.Method != "GET" || info.URL != "/panic" || info.Value != "boom" {
+		t.Fatalf("PanicInfo() failed: %+v", info)
+	}
+	if out := buf.String(); strings.Count(out, "handler panicked") != 1 || !strings.Contains(out, "link=panicker") {
+		t.Fatalf("PanicInfo() failed to log: %s", out)
+	}
+	if outer.IsRunning() || inner.IsRunning() {
+		t.Fatal("panic left chain running")
+	}
+
+	if _, ok := PanicInfo("other"); ok {
+		t.Fatal("PanicInfo() failed")
+	}
+}
+
+func TestPanicAbortHandler(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("abort", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}()
+	if recovered != http.ErrAbortHandler {
+		t.Fatal("ErrAbortHandler was not passed through")
+	}
+}
+
+func TestOnHandlerPanic(t *testing.T) {
+
+	type call struct {
+		chain, name string
+		recovered   interface{}
+		stack       []byte
+	}
+	var calls []call
+	hook := func(chain string) func(string, interface{}, []byte) {
+		return func(name string, recovered interface{}, stack []byte) {
+			calls = append(calls, call{chain, name, recovered, stack})
+		}
+	}
+
+	inner := New(testkey)
+	inner.Append("panicker", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	inner.SetOnHandlerPanic(hook("inner"))
+	outer := New(testkey)
+	outer.Append("nested", inner)
+	outer.SetOnHandlerPanic(hook("outer"))
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		outer.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}()
+	if _, ok := PanicInfo(recovered); !ok {
+		t.Fatal("SetOnHandlerPanic() suppressed the panic")
+	}
+	if len(calls) != 1 || calls[0].chain != "inner" || calls[0].name != "panicker" || calls[0].recovered != "boom" ||
+		!bytes.Contains(calls[0].stack, []byte("TestOnHandlerPanic")) {
+		t.Fatalf("SetOnHandlerPanic() failed: %v", calls)
+	}
+}
+
+func TestRecoveryFunc(t *testing.T) {
+
+	type appError struct{ error }
+
+	var got interface{}
+	c := New(testkey, WithRecoveryFunc(func(recovered interface{}) error {
+		got = recovered
+		return appError{recovered.(error)}
+	}))
+	c.Append("panicker", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if _, ok := c.LastError().(appError); !ok {
+		t.Fatal("WithRecoveryFunc() failed")
+	}
+	if info, ok := PanicInfo(got); !ok || info.Link != "panicker" || info.Value != "boom" {
+		t.Fatal("WithRecoveryFunc() failed")
+	}
+	if trace := c.LastRun().Trace; len(trace) != 1 {
+		t.Fatal("WithRecoveryFunc() failed to stop the chain")
+	}
+
+	c = New(testkey, WithRecoveryFunc(func(interface{}) error { return nil }))
+	c.Append("panicker", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	c.Append("h2", MakeHandler("h2"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastError() != nil || len(c.LastRun().Trace) != 2 {
+		t.Fatal("WithRecoveryFunc() failed to suppress the panic")
+	}
+
+	c = New(testkey, WithRecoveryFunc(func(interface{}) error { return nil }))
+	c.Append("abort", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}()
+	if recovered != http.ErrAbortHandler {
+		t.Fatal("WithRecoveryFunc() recovered http.ErrAbortHandler")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCIDR is returned by RemoteIPIn if a CIDR cannot be parsed.
+var ErrInvalidCIDR = ErrChainer.WrapFormat("invalid CIDR '%s'")
+
+// Predicate reports whether a request matches a condition. Predicates
+// can be passed wherever a func(*http.Request) bool is accepted, such as
+// WithTee and WithObservabilitySampling.
+type Predicate func(*http.Request) bool
+
+// MethodIs returns a Predicate matching requests with any of methods.
+func MethodIs(methods ...string) Predicate {
+	return func(r *http.Request) bool {
+		for _, method := range methods {
+			if r.Method == method {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PathPrefix returns a Predicate matching requests whose URL path starts
+// with prefix.
+func PathPrefix(prefix string) Predicate {
+	return func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, prefix) }
+}
+
+// HeaderEquals returns a Predicate matching requests whose first value of
+// header key equals value.
+func HeaderEquals(key, value string) Predicate {
+	return func(r *http.Request) bool { return r.Header.Get(key) == value }
+}
+
+// HostIs returns a Predicate matching requests whose host, without port,
+// equals host, compared case insensitively.
+func HostIs(host string) Predicate {
+	return func(r *http.Request) bool {
+		h := r.Host
+		if hostname, _, err := net.SplitHostPort(h); err == nil {
+			h = hostname
+		}
+		return strings.EqualFold(strings.Trim(h, "[]"), strings.Trim(host, "[]"))
+	}
+}
+
+// RemoteIPIn returns a Predicate matching requests whose remote address,
+// as set by the server in http.Request.RemoteAddr, is in any of cidrs,
+// which may be IPv4 or IPv6 CIDRs. If a CIDR cannot be parsed
+// ErrInvalidCIDR sibling is returned.
+//
+// Forwarding headers such as X-Forwarded-For are not considered; rewrite
+// RemoteAddr in a trusted handler before the predicate is evaluated if
+// the server is behind a proxy.
+func RemoteIPIn(cidrs ...string) (Predicate, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, ErrInvalidCIDR.WrapArgs(cidr)
+		}
+		nets = append(nets, ipnet)
+	}
+	return func(r *http.Request) bool {
+		host := r.RemoteAddr
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		for _, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// And returns a Predicate matching requests matched by all of predicates.
+// It matches all requests if no predicates are specified.
+func And(predicates ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		for _, p := range predicates {
+			if !p(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Predicate matching requests matched by any of predicates.
+// It matches no requests if no predicates are specified.
+func Or(predicates ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		for _, p := range predicates {
+			if p(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Predicate matching requests not matched by p.
+func Not(p Predicate) Predicate {
+	return func(r *http.Request) bool { return !p(r) }
+}
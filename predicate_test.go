@@ -0,0 +1,75 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPredicates(t *testing.T) {
+
+	req := func(method, target, remote string, header ...string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = remote
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		return r
+	}
+
+	local, err := RemoteIPIn("10.0.0.0/8", "fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoteIPIn("10.0.0.0/8", "bogus"); !errors.Is(err, ErrInvalidCIDR) {
+		t.Fatal("RemoteIPIn() failed to reject invalid CIDR")
+	}
+
+	get := req("GET", "http://Example.com:8080/api/users", "10.1.2.3:1234", "X-Flag", "on")
+	post := req("POST", "http://other.org/static", "[fd00::1]:443")
+	remote := req("PUT", "http://[::1]/", "192.168.1.1:80", "X-Forwarded-For", "10.0.0.1")
+
+	for _, test := range []struct {
+		name string
+		p    Predicate
+		r    *http.Request
+		want bool
+	}{
+		{"MethodIs", MethodIs("GET", "HEAD"), get, true},
+		{"MethodIs", MethodIs("GET", "HEAD"), post, false},
+		{"PathPrefix", PathPrefix("/api/"), get, true},
+		{"PathPrefix", PathPrefix("/api/"), post, false},
+		{"HeaderEquals", HeaderEquals("x-flag", "on"), get, true},
+		{"HeaderEquals", HeaderEquals("X-Flag", "on"), post, false},
+		{"HostIs", HostIs("example.com"), get, true},
+		{"HostIs", HostIs("example.com"), post, false},
+		{"HostIs", HostIs("::1"), remote, true},
+		{"RemoteIPIn", local, get, true},
+		{"RemoteIPIn IPv6", local, post, true},
+		{"RemoteIPIn X-Forwarded-For", local, remote, false},
+		{"And", And(MethodIs("GET"), PathPrefix("/api")), get, true},
+		{"And", And(MethodIs("GET"), PathPrefix("/static")), get, false},
+		{"And empty", And(), get, true},
+		{"Or", Or(MethodIs("DELETE"), PathPrefix("/static")), post, true},
+		{"Or", Or(MethodIs("DELETE"), PathPrefix("/api")), post, false},
+		{"Or empty", Or(), get, false},
+		{"Not", Not(MethodIs("GET")), post, true},
+		{"Not", Not(MethodIs("GET")), get, false},
+	} {
+		if got := test.p(test.r); got != test.want {
+			t.Fatalf("%s() failed for %s %s", test.name, test.r.Method, test.r.URL)
+		}
+	}
+
+	c := New(testkey, WithObservabilitySampling(PathPrefix("/api")))
+	c.Append("h1", MakeHandler("h1"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/api/users"))
+	if !c.LastRun().Sampled {
+		t.Fatal("Predicate failed as sampling function")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// ErrProxy is set as the chain error when a handler returned by Proxy
+// fails to proxy a request.
+var ErrProxy = ErrChainer.WrapFormat("proxy '%s': %v")
+
+// ProxyOptions are options of a handler returned by Proxy.
+type ProxyOptions struct {
+	// Vars maps keys of chain variables to names of request headers the
+	// variables are sent to the upstream in. Values are formatted using
+	// fmt.Sprint. Variables that are not set are not sent.
+	Vars map[string]string
+	// Timeout limits the duration of a proxied request if greater than 0.
+	Timeout time.Duration
+	// Transport is the transport used to reach the upstream. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// Proxy returns a handler that proxies requests to target using a
+// httputil.ReverseProxy as returned by httputil.NewSingleHostReverseProxy.
+//
+// Upstream responses, including error responses, are passed through to
+// the client. If the upstream cannot be reached or does not respond
+// within ProxyOptions.Timeout, ErrProxy sibling naming the handler by name
+// is set as the error of the innermost chain executing the handler so
+// that it is handled by the chain error handler set by SetErrorHandler.
+// If the chain has no error handler, 502 Bad Gateway is written.
+func Proxy(name string, target *url.URL, opts ProxyOptions) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = opts.Transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		chain, exists := FromContext(r.Context())
+		if !exists {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		chain.SetError(ErrProxy.WrapArgs(name, err))
+		if chain.errorfunc == nil {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(opts.Vars) > 0 {
+			if chain, exists := FromContext(r.Context()); exists {
+				r = r.Clone(r.Context())
+				for key, header := range opts.Vars {
+					if val, ok := chain.Get(key); ok {
+						r.Header.Set(header, fmt.Sprint(val))
+					}
+				}
+			}
+		}
+		if opts.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), opts.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
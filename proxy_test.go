@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			http.Error(w, "upstream failed", http.StatusInternalServerError)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			fmt.Fprintf(w, "user=%s id=%s", r.Header.Get("X-User"), r.Header.Get("X-Id"))
+		}
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	c := New(testkey)
+	c.Append("vars", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Set("user", "bob")
+		c.Set("id", 42)
+	}))
+	c.Append("proxy", Proxy("upstream", target, ProxyOptions{
+		Vars:    map[string]string{"user": "X-User", "id": "X-Id", "missing": "X-Missing"},
+		Timeout: 20 * time.Millisecond,
+	}))
+
+	// Success with header export.
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "user=bob id=42" || c.LastError() != nil {
+		t.Fatalf("Proxy() failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Upstream 5xx passthrough.
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/fail", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "upstream failed\n" || c.LastError() != nil {
+		t.Fatal("Proxy() failed to pass through upstream error")
+	}
+
+	// Timeout becomes a chain error.
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if !errors.Is(c.LastError(), ErrProxy) || rec.Code != http.StatusBadGateway {
+		t.Fatal("Proxy() failed to time out")
+	}
+}
+
+func TestProxyConnectionRefused(t *testing.T) {
+
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	c := New(testkey)
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	c.Append("proxy", Proxy("upstream", target, ProxyOptions{}))
+	c.Append("after", MakeHandler("after"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !errors.Is(c.LastError(), ErrProxy) || rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "unavailable\n" {
+		t.Fatalf("Proxy() failed: %v %d", c.LastError(), rec.Code)
+	}
+	if info := c.info(""); info.Failures != 1 {
+		t.Fatal("Proxy() error not counted")
+	}
+}
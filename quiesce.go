@@ -0,0 +1,77 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import "context"
+
+// Quiesce stops the chain from serving new requests and waits until all
+// requests currently being served finish or ctx is done, in which case
+// ctx error is returned. New requests are queued until Resume is called.
+// Once Quiesce returns nil the chain can be safely reconfigured.
+//
+// The chain remains quiesced even if ctx is done, so Resume must always
+// be called. Quiesce must not be called from a handler executing in the
+// chain as it would wait for itself.
+func (c *Chain) Quiesce(ctx context.Context) error {
+	c.qmu.Lock()
+	if !c.quiescing {
+		c.quiescing = true
+		c.resume = make(chan struct{})
+	}
+	if c.active == 0 {
+		c.qmu.Unlock()
+		return nil
+	}
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+	}
+	drained := c.drained
+	c.qmu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume resumes serving requests after Quiesce, including queued ones.
+func (c *Chain) Resume() {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+
+	if c.quiescing {
+		c.quiescing = false
+		close(c.resume)
+	}
+}
+
+// enter waits until the chain is not quiesced and registers a request
+// as active.
+func (c *Chain) enter() {
+	for {
+		c.qmu.Lock()
+		if !c.quiescing {
+			c.active++
+			c.qmu.Unlock()
+			return
+		}
+		resume := c.resume
+		c.qmu.Unlock()
+		<-resume
+	}
+}
+
+// leave unregisters an active request.
+func (c *Chain) leave() {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+
+	if c.active--; c.active == 0 && c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+}
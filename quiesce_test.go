@@ -0,0 +1,55 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQuiesce(t *testing.T) {
+
+	var served int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	c := New(testkey)
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		atomic.AddInt32(&served, 1)
+	}))
+
+	go c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Quiesce(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Quiesce() failed to time out")
+	}
+
+	done := make(chan error)
+	go func() { done <- c.Quiesce(context.Background()) }()
+	go c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&served) != 1 {
+		t.Fatal("Quiesce() failed to queue new request")
+	}
+
+	c.Resume()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&served) != 2 {
+		t.Fatal("Resume() failed")
+	}
+}
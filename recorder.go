@@ -0,0 +1,146 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// errNotHijacker is returned by recorder.Hijack if the underlying
+// http.ResponseWriter does not implement http.Hijacker.
+var errNotHijacker = errors.New("chainer: http.ResponseWriter does not implement http.Hijacker")
+
+// recorder is a http.ResponseWriter that records the response status and
+// the number of bytes written.
+type recorder struct {
+	written int64
+	http.ResponseWriter
+	status  int
+	closed  int32
+	aborted int32
+	timeout int32
+	onlate  func() error
+}
+
+// newRecorder returns a new recorder wrapping w.
+func newRecorder(w http.ResponseWriter) *recorder {
+	return &recorder{ResponseWriter: w}
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (rec *recorder) WriteHeader(status int) { rec.writeHeader(status, false) }
+
+// Write implements http.ResponseWriter.Write.
+func (rec *recorder) Write(b []byte) (int, error) { return rec.write(b, false) }
+
+// writeHeader writes the response header unless the recorder stopped for
+// a write that is not dispatch, see dispatchWriter.
+func (rec *recorder) writeHeader(status int, dispatch bool) {
+	if rec.stopped(dispatch) {
+		rec.onlate()
+		return
+	}
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// write writes the response body unless the recorder stopped for a write
+// that is not dispatch, see dispatchWriter.
+func (rec *recorder) write(b []byte, dispatch bool) (int, error) {
+	if rec.stopped(dispatch) {
+		return 0, rec.onlate()
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	atomic.AddInt64(&rec.written, int64(n))
+	if err == http.ErrHandlerTimeout {
+		atomic.StoreInt32(&rec.timeout, 1)
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher.Flush if the underlying writer supports it.
+func (rec *recorder) Flush() { rec.flush(false) }
+
+// flush flushes the response unless the recorder stopped for a flush that
+// is not dispatch, see dispatchWriter.
+func (rec *recorder) flush(dispatch bool) {
+	if rec.stopped(dispatch) {
+		rec.onlate()
+		return
+	}
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.Hijack if the underlying writer
+// supports it.
+func (rec *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errNotHijacker
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (rec *recorder) Unwrap() http.ResponseWriter { return rec.ResponseWriter }
+
+// bytes returns the number of response body bytes written.
+func (rec *recorder) bytes() int64 { return atomic.LoadInt64(&rec.written) }
+
+// Written returns true if response header or body were written.
+func (rec *recorder) Written() bool { return rec.status != 0 }
+
+// close makes the recorder discard all subsequent writes and report them
+// by calling onlate.
+func (rec *recorder) close(onlate func() error) {
+	rec.onlate = onlate
+	atomic.StoreInt32(&rec.closed, 1)
+}
+
+// abort makes the recorder report all subsequent writes by calling
+// onlate and discard them, except writes made through the dispatchWriter
+// of the recorder.
+func (rec *recorder) abort(onlate func() error) {
+	rec.onlate = onlate
+	atomic.StoreInt32(&rec.aborted, 1)
+}
+
+// stopped returns true if the recorder was closed or, unless dispatch is
+// true, aborted.
+func (rec *recorder) stopped(dispatch bool) bool {
+	return atomic.LoadInt32(&rec.closed) != 0 || !dispatch && atomic.LoadInt32(&rec.aborted) != 0
+}
+
+// dispatchWriter writes to a recorder past its abort. It is used by the
+// chain to dispatch the result of an aborted run.
+type dispatchWriter struct {
+	*recorder
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (dw dispatchWriter) WriteHeader(status int) { dw.writeHeader(status, true) }
+
+// Write implements http.ResponseWriter.Write.
+func (dw dispatchWriter) Write(b []byte) (int, error) { return dw.write(b, true) }
+
+// Flush implements http.Flusher.Flush if the underlying writer supports it.
+func (dw dispatchWriter) Flush() { dw.flush(true) }
+
+// timedOut returns true if a write to the underlying writer failed with
+// http.ErrHandlerTimeout.
+func (rec *recorder) timedOut() bool { return atomic.LoadInt32(&rec.timeout) != 0 }
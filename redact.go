@@ -0,0 +1,95 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Redacted is the value DefaultVarRedactor replaces secret values with.
+const Redacted = "[REDACTED]"
+
+// secretPatterns are lower case substrings of variable keys considered
+// secret by DefaultVarRedactor.
+var secretPatterns = []string{
+	"password", "passwd", "secret", "token", "apikey", "api_key", "api-key",
+	"auth", "cookie", "session", "credential", "private",
+}
+
+// WithVarRedactor enables exposing chain variables in ChainInfo served by
+// Registry.OverviewHandler and sets a function that is consulted for every
+// context variable whenever chain variables are exposed for introspection.
+// It returns the value to expose in place of val and true or false to omit
+// the variable. Get, Set, ExportVars and other variable methods are not
+// affected.
+//
+// Chains created without WithVarRedactor do not expose variables in
+// ChainInfo. Variables explicitly published with PublishExpvar are
+// processed by DefaultVarRedactor if no redactor is set.
+func WithVarRedactor(fn func(key string, val interface{}) (interface{}, bool)) Option {
+	return func(c *Chain) { c.redactor = fn }
+}
+
+// DefaultVarRedactor is the default variable redactor. It replaces values
+// of variables whose keys contain common secret patterns such as
+// "password", "token", "secret", "auth" or "session", compared case
+// insensitively, with Redacted and passes other values unmodified.
+// Values are not inspected so secrets stored under other keys or nested
+// in maps or structs are exposed; prefer a redactor that allows known
+// keys when exposing variables of chains that may hold secrets.
+func DefaultVarRedactor(key string, val interface{}) (interface{}, bool) {
+	lower := strings.ToLower(key)
+	for _, pattern := range secretPatterns {
+		if strings.Contains(lower, pattern) {
+			return Redacted, true
+		}
+	}
+	return val, true
+}
+
+// redactedVars returns a copy of chain variables processed by the chain
+// variable redactor or nil if there are no variables to expose or the
+// chain has no redactor.
+func (c *Chain) redactedVars() map[string]interface{} {
+	if c.redactor == nil {
+		return nil
+	}
+	c.varmu.Lock()
+	vars := copyVars(c.vars)
+	c.varmu.Unlock()
+
+	var result map[string]interface{}
+	for key, val := range vars {
+		val, include := c.redact(key, val)
+		if !include {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]interface{}, len(vars))
+		}
+		result[key] = val
+	}
+	return result
+}
+
+// redact returns val of variable key processed by the chain variable
+// redactor and true or nil and false if the variable should be omitted.
+// Values that cannot be marshaled to JSON are replaced by their type name.
+func (c *Chain) redact(key string, val interface{}) (interface{}, bool) {
+	redactor := c.redactor
+	if redactor == nil {
+		redactor = DefaultVarRedactor
+	}
+	val, include := redactor(key, val)
+	if !include {
+		return nil, false
+	}
+	if _, err := json.Marshal(val); err != nil {
+		val = fmt.Sprintf("%T", val)
+	}
+	return val, true
+}
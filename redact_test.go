@@ -0,0 +1,80 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultVarRedactor(t *testing.T) {
+
+	for _, key := range []string{"password", "X-Auth-Token", "SessionID", "client_secret"} {
+		if val, ok := DefaultVarRedactor(key, "s3cr3t"); !ok || val != Redacted {
+			t.Fatalf("DefaultVarRedactor() failed for '%s'", key)
+		}
+	}
+	if val, ok := DefaultVarRedactor("user", "bob"); !ok || val != "bob" {
+		t.Fatal("DefaultVarRedactor() failed")
+	}
+}
+
+func TestVarRedactor(t *testing.T) {
+
+	overview := func(c *Chain) map[string]interface{} {
+		registry := NewRegistry()
+		registry.RegisterChain("chain", c)
+		rec := httptest.NewRecorder()
+		registry.OverviewHandler().ServeHTTP(rec, MakeRequest("/"))
+		infos := make(map[string]*ChainInfo)
+		if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+			t.Fatal(err)
+		}
+		return infos["chain"].Vars
+	}
+
+	var seen interface{}
+	c := New(testkey)
+	c.Set("token", "s3cr3t")
+	c.Set("user", "bob")
+	c.Set("callback", func() {})
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = c.Get("token")
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if seen != "s3cr3t" {
+		t.Fatal("Get() returned redacted value")
+	}
+	if vars := overview(c); vars != nil {
+		t.Fatalf("OverviewHandler() exposed vars by default: %v", vars)
+	}
+
+	c = New(testkey, WithVarRedactor(DefaultVarRedactor))
+	c.Set("token", "s3cr3t")
+	c.Set("user", "bob")
+	c.Set("callback", func() {})
+	vars := overview(c)
+	if vars["token"] != Redacted || vars["user"] != "bob" || vars["callback"] != "func()" {
+		t.Fatalf("OverviewHandler() failed: %v", vars)
+	}
+
+	c = New(testkey, WithVarRedactor(func(key string, val interface{}) (interface{}, bool) {
+		if key == "user" {
+			return nil, false
+		}
+		return "***", true
+	}))
+	c.Set("token", "s3cr3t")
+	c.Set("user", "bob")
+	vars = overview(c)
+	if len(vars) != 1 || vars["token"] != "***" {
+		t.Fatalf("WithVarRedactor() failed: %v", vars)
+	}
+	if val, _ := c.Get("token"); val != "s3cr3t" {
+		t.Fatal("WithVarRedactor() affected Get()")
+	}
+}
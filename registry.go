@@ -0,0 +1,151 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrRegistered is returned by RegisterChain if a chain is already
+// registered with a Registry.
+var ErrRegistered = ErrChainer.WrapFormat("chain already registered as '%s'")
+
+// ChainInfo is a summary of a registered chain.
+type ChainInfo struct {
+	// Name is the name the chain was registered under.
+	Name string `json:"name"`
+	// Length is the number of handlers in the chain.
+	Length int `json:"length"`
+	// Handlers are the names of handlers in the chain in execution order.
+	Handlers []string `json:"handlers"`
+	// InFlight is the number of requests currently being served
+	// or waiting to be served by the chain.
+	InFlight int `json:"inflight"`
+	// Requests is the number of requests the chain served.
+	Requests uint64 `json:"requests"`
+	// Failures is the number of requests that ended with an error.
+	Failures uint64 `json:"failures"`
+	// TeeErrors is the number of failed writes to response tee sinks.
+	TeeErrors uint64 `json:"teeerrors"`
+	// LateWrites is the number of writes detected after a request was
+	// served if late write detection is enabled.
+	LateWrites uint64 `json:"latewrites"`
+	// Vars are the chain's own context variables as returned by the chain
+	// variable redactor. Vars are exposed only by chains created with
+	// WithVarRedactor and are omitted otherwise.
+	Vars map[string]interface{} `json:"vars,omitempty"`
+}
+
+// Registry is a registry of named chains used for introspection.
+// Registration is optional and a chain can be registered with multiple
+// Registries. Chains deregister from all Registries on Chain.Close.
+type Registry struct {
+	mu     sync.Mutex
+	chains map[string]*Chain
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		mu:     sync.Mutex{},
+		chains: make(map[string]*Chain),
+	}
+}
+
+// DefaultRegistry is the Registry used by package level functions.
+var DefaultRegistry = NewRegistry()
+
+// RegisterChain registers c under name with DefaultRegistry.
+func RegisterChain(name string, c *Chain) error {
+	return DefaultRegistry.RegisterChain(name, c)
+}
+
+// Chains returns infos of chains registered with DefaultRegistry.
+func Chains() map[string]*ChainInfo { return DefaultRegistry.Chains() }
+
+// OverviewHandler returns the overview handler of DefaultRegistry.
+func OverviewHandler() http.Handler { return DefaultRegistry.OverviewHandler() }
+
+// RegisterChain registers c under name which must be unique in the
+// registry or ErrDupName sibling is returned. If c is already registered
+// with this registry ErrRegistered sibling is returned.
+func (r *Registry) RegisterChain(name string, c *Chain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.chains[name]; exists {
+		return ErrDupName.WrapArgs(name)
+	}
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+	if existing, exists := c.registries[r]; exists {
+		return ErrRegistered.WrapArgs(existing)
+	}
+	c.registries[r] = name
+	r.chains[name] = c
+	return nil
+}
+
+// deregister removes c registered under name from the registry.
+func (r *Registry) deregister(name string, c *Chain) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.chains[name] == c {
+		delete(r.chains, name)
+	}
+}
+
+// Chains returns infos of all chains in the registry keyed by name.
+func (r *Registry) Chains() map[string]*ChainInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make(map[string]*ChainInfo, len(r.chains))
+	for name, c := range r.chains {
+		infos[name] = c.info(name)
+	}
+	return infos
+}
+
+// OverviewHandler returns a handler that serves infos of all chains in the
+// registry as a JSON object keyed by chain name.
+func (r *Registry) OverviewHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, err := json.Marshal(r.Chains())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+// info returns a ChainInfo of c under name.
+// It does not share the lock with ServeHTTP so that it can be called from
+// a handler executing in c.
+func (c *Chain) info(name string) *ChainInfo {
+	c.varmu.Lock()
+	handlers := make([]string, len(c.indexes))
+	copy(handlers, c.indexes)
+	c.varmu.Unlock()
+
+	return &ChainInfo{
+		Name:     name,
+		Length:   len(handlers),
+		Handlers: handlers,
+		InFlight: int(atomic.LoadInt32(&c.inflight)),
+		Requests: atomic.LoadUint64(&c.requests),
+		Failures: atomic.LoadUint64(&c.failures),
+
+		TeeErrors:  atomic.LoadUint64(&c.teeerrs),
+		LateWrites: atomic.LoadUint64(&c.latewrs),
+		Vars:       c.redactedVars(),
+	}
+}
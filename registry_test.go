@@ -0,0 +1,65 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+
+	registry := NewRegistry()
+
+	ch1 := New(testkey)
+	ch1.Append("h1", MakeHandler("h1"))
+	ch2 := New(testkey)
+	ch2.Append("h1", MakeHandler("h1"))
+	ch2.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	ch3 := New(testkey)
+	ch3.Append("h1", MakeHandler("h1"))
+	ch3.Append("h2", MakeHandler("h2"))
+	ch3.Append("h3", MakeHandler("h3"))
+
+	for name, c := range map[string]*Chain{"one": ch1, "two": ch2, "three": ch3} {
+		if err := registry.RegisterChain(name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.RegisterChain("one", New(testkey)); !errors.Is(err, ErrDupName) {
+		t.Fatal("RegisterChain() failed")
+	}
+	if err := registry.RegisterChain("four", ch1); !errors.Is(err, ErrRegistered) {
+		t.Fatal("RegisterChain() failed")
+	}
+
+	ch2.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+
+	rec := httptest.NewRecorder()
+	registry.OverviewHandler().ServeHTTP(rec, MakeRequest("/"))
+	infos := make(map[string]*ChainInfo)
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatal("OverviewHandler() failed")
+	}
+	if info := infos["three"]; info == nil || info.Length != 3 || info.Handlers[2] != "h3" {
+		t.Fatal("OverviewHandler() failed")
+	}
+	if info := infos["two"]; info == nil || info.Requests != 1 || info.Failures != 1 {
+		t.Fatal("OverviewHandler() failed")
+	}
+
+	ch2.Close()
+	if _, exists := registry.Chains()["two"]; exists {
+		t.Fatal("Close() failed")
+	}
+	if len(registry.Chains()) != 2 {
+		t.Fatal("Close() failed")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+)
+
+// Default values of headers set by SecurityHeaders.
+const (
+	DefaultContentTypeOptions      = "nosniff"
+	DefaultFrameOptions            = "DENY"
+	DefaultReferrerPolicy          = "strict-origin-when-cross-origin"
+	DefaultCrossOriginOpenerPolicy = "same-origin"
+	DefaultStrictTransportSecurity = "max-age=63072000; includeSubDomains"
+)
+
+// SecurityOptions are options of SecurityHeaders. Empty values select
+// the respective default.
+type SecurityOptions struct {
+	// ContentTypeOptions is the X-Content-Type-Options header value.
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header value.
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header value.
+	ReferrerPolicy string
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy header
+	// value.
+	CrossOriginOpenerPolicy string
+	// StrictTransportSecurity is the Strict-Transport-Security header
+	// value. It is set only for requests received over TLS.
+	StrictTransportSecurity string
+	// ContentSecurityPolicy is the Content-Security-Policy header value.
+	// It has no default and is not set if empty.
+	ContentSecurityPolicy string
+	// Disable lists names of headers that are not set.
+	Disable []string
+}
+
+// SecurityHeaders returns a handler that sets common security response
+// headers as specified by opts and continues the chain. Headers already
+// set by preceding handlers are overwritten.
+func SecurityHeaders(opts SecurityOptions) http.Handler {
+	headers := []struct{ name, value, def string }{
+		{"X-Content-Type-Options", opts.ContentTypeOptions, DefaultContentTypeOptions},
+		{"X-Frame-Options", opts.FrameOptions, DefaultFrameOptions},
+		{"Referrer-Policy", opts.ReferrerPolicy, DefaultReferrerPolicy},
+		{"Cross-Origin-Opener-Policy", opts.CrossOriginOpenerPolicy, DefaultCrossOriginOpenerPolicy},
+		{"Content-Security-Policy", opts.ContentSecurityPolicy, ""},
+	}
+	disabled := make(map[string]bool, len(opts.Disable))
+	for _, name := range opts.Disable {
+		disabled[http.CanonicalHeaderKey(name)] = true
+	}
+	set := make(http.Header)
+	for _, header := range headers {
+		if disabled[header.name] {
+			continue
+		}
+		if header.value == "" {
+			header.value = header.def
+		}
+		if header.value != "" {
+			set.Set(header.name, header.value)
+		}
+	}
+	hsts := opts.StrictTransportSecurity
+	if hsts == "" {
+		hsts = DefaultStrictTransportSecurity
+	}
+	if disabled["Strict-Transport-Security"] {
+		hsts = ""
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for name, values := range set {
+			h[name] = append([]string(nil), values...)
+		}
+		if hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+	})
+}
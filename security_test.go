@@ -0,0 +1,56 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("security", SecurityHeaders(SecurityOptions{}))
+	c.Append("h1", MakeHandler("h1"))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	h := rec.Header()
+	if h.Get("X-Content-Type-Options") != DefaultContentTypeOptions ||
+		h.Get("X-Frame-Options") != DefaultFrameOptions ||
+		h.Get("Referrer-Policy") != DefaultReferrerPolicy ||
+		h.Get("Cross-Origin-Opener-Policy") != DefaultCrossOriginOpenerPolicy {
+		t.Fatal("SecurityHeaders() failed")
+	}
+	if _, exists := h["Content-Security-Policy"]; exists {
+		t.Fatal("SecurityHeaders() failed")
+	}
+	if _, exists := h["Strict-Transport-Security"]; exists {
+		t.Fatal("SecurityHeaders() failed, HSTS set without TLS")
+	}
+	if rec.Body.Len() == 0 {
+		t.Fatal("SecurityHeaders() failed to continue the chain")
+	}
+
+	c = New(testkey)
+	c.Append("security", SecurityHeaders(SecurityOptions{
+		FrameOptions: "SAMEORIGIN",
+		Disable:      []string{"referrer-policy"},
+	}))
+	rec = httptest.NewRecorder()
+	req := MakeRequest("/")
+	req.TLS = &tls.ConnectionState{}
+	c.ServeHTTP(rec, req)
+	h = rec.Header()
+	if h.Get("X-Frame-Options") != "SAMEORIGIN" || h.Get("X-Content-Type-Options") != DefaultContentTypeOptions {
+		t.Fatal("SecurityHeaders() failed to override")
+	}
+	if _, exists := h["Referrer-Policy"]; exists {
+		t.Fatal("SecurityHeaders() failed to disable")
+	}
+	if h.Get("Strict-Transport-Security") != DefaultStrictTransportSecurity {
+		t.Fatal("SecurityHeaders() failed to set HSTS")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StatsSamples is the number of most recent handler execution durations
+// kept per handler for percentile estimation.
+const StatsSamples = 1024
+
+// HandlerStats are execution statistics of a handler in a chain.
+type HandlerStats struct {
+	// CallCount is the number of times the handler was executed.
+	CallCount int64
+	// TotalDuration is the cumulative execution time of the handler.
+	TotalDuration time.Duration
+
+	// samples are sorted most recent execution durations.
+	samples []time.Duration
+}
+
+// AverageDuration returns the average execution time of the handler.
+func (hs HandlerStats) AverageDuration() time.Duration {
+	if hs.CallCount == 0 {
+		return 0
+	}
+	return hs.TotalDuration / time.Duration(hs.CallCount)
+}
+
+// Percentile returns the approximate p-th percentile, 0 < p <= 100, of the
+// handler execution time computed over the last StatsSamples executions
+// using the nearest-rank method. Returns 0 if there are no samples.
+func (hs HandlerStats) Percentile(p float64) time.Duration {
+	if len(hs.samples) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(hs.samples))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(hs.samples) {
+		rank = len(hs.samples)
+	}
+	return hs.samples[rank-1]
+}
+
+// handlerStats holds execution statistics of a handler.
+// It is updated without locking.
+type handlerStats struct {
+	calls   int64
+	total   int64
+	next    uint64
+	samples [StatsSamples]int64
+}
+
+// record records an execution that lasted d.
+func (hs *handlerStats) record(d time.Duration) {
+	atomic.AddInt64(&hs.calls, 1)
+	atomic.AddInt64(&hs.total, int64(d))
+	i := (atomic.AddUint64(&hs.next, 1) - 1) % StatsSamples
+	atomic.StoreInt64(&hs.samples[i], int64(d))
+}
+
+// snapshot returns HandlerStats of hs.
+func (hs *handlerStats) snapshot() HandlerStats {
+	n := atomic.LoadUint64(&hs.next)
+	if n > StatsSamples {
+		n = StatsSamples
+	}
+	samples := make([]time.Duration, 0, n)
+	for i := uint64(0); i < n; i++ {
+		samples = append(samples, time.Duration(atomic.LoadInt64(&hs.samples[i])))
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return HandlerStats{
+		CallCount:     atomic.LoadInt64(&hs.calls),
+		TotalDuration: time.Duration(atomic.LoadInt64(&hs.total)),
+		samples:       samples,
+	}
+}
+
+// Stats returns execution statistics of handlers in the chain keyed by
+// handler name and of Balancer members keyed by their trace entry.
+func (c *Chain) Stats() map[string]HandlerStats {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	r := make(map[string]HandlerStats, len(c.stats))
+	for name, hs := range c.stats {
+		r[name] = hs.snapshot()
+	}
+	return r
+}
+
+// CountCalls returns the total number of handler executions in the chain
+// as reported by HandlerStats.CallCount of all handlers, without taking a
+// snapshot of statistics.
+func (c *Chain) CountCalls() (n int64) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	for _, hs := range c.stats {
+		n += atomic.LoadInt64(&hs.calls)
+	}
+	return
+}
+
+// TotalDuration returns the cumulative execution time of all handlers in
+// the chain as reported by HandlerStats.TotalDuration of all handlers,
+// without taking a snapshot of statistics.
+func (c *Chain) TotalDuration() (d time.Duration) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	for _, hs := range c.stats {
+		d += time.Duration(atomic.LoadInt64(&hs.total))
+	}
+	return
+}
+
+// ResetStats clears handler statistics reported by Stats, counters set by
+// WithCounters, counts reported by ErrorStatusCounts and data of the last
+// run as Reset does, so that instrumentation of repeated benchmarks and
+// tests starts from zero. Request and failure counts reported by a
+// Registry are kept.
+// ResetStats shares the lock with ServeHTTP.
+func (c *Chain) ResetStats() {
+	c.runmu.Lock()
+	defer c.runmu.Unlock()
+
+	c.reset()
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+	c.ran = false
+	for name := range c.stats {
+		c.stats[name] = &handlerStats{}
+	}
+	if c.counters != nil {
+		c.counters = make(map[string]*int64)
+	}
+	if c.statuses != nil {
+		c.statuses = make(map[int]*uint64)
+	}
+}
+
+// recordStats records an execution of link at index i that lasted d.
+// runmu must be locked by the caller.
+func (c *Chain) recordStats(i int, d time.Duration) {
+	if i >= len(c.indexes) {
+		return
+	}
+	if hs, exists := c.stats[c.indexes[i]]; exists {
+		hs.record(d)
+	}
+}
+
+// dropStats removes statistics of the handler registered under key,
+// including entries of its Balancer members. varmu must be locked by the
+// caller.
+func (c *Chain) dropStats(key string) {
+	delete(c.stats, key)
+	for entry := range c.stats {
+		if strings.HasPrefix(entry, key+"→") {
+			delete(c.stats, entry)
+		}
+	}
+}
+
+// recordEntry records an execution of a handler that is not a link of
+// the chain, such as a Balancer member, under entry if the run is sampled
+// and counts it if counters are enabled. runmu must be locked by the
+// caller.
+func (c *Chain) recordEntry(entry string, d time.Duration) {
+	c.varmu.Lock()
+	hs, exists := c.stats[entry]
+	if !exists && c.sampled {
+		hs = &handlerStats{}
+		c.stats[entry] = hs
+	}
+	sampled := c.sampled
+	c.varmu.Unlock()
+	if sampled {
+		hs.record(d)
+	}
+	c.countName(entry)
+}
+
+// WithCounters enables lightweight counters of handler executions kept
+// for the lifetime of the chain and reported by Counts. Unlike Stats,
+// counters record nothing but the number of executions.
+func WithCounters() Option {
+	return func(c *Chain) { c.counting = true }
+}
+
+// Counts returns the number of executions of each handler that was
+// executed at least once, keyed by handler name, or nil if counters were
+// not enabled with WithCounters.
+func (c *Chain) Counts() map[string]int64 {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if !c.counting {
+		return nil
+	}
+	r := make(map[string]int64, len(c.counters))
+	for name, count := range c.counters {
+		r[name] = atomic.LoadInt64(count)
+	}
+	return r
+}
+
+// count increments the execution counter of link at index i if counters
+// are enabled. runmu must be locked by the caller.
+func (c *Chain) count(i int) { c.countName(c.indexes[i]) }
+
+// countName increments the execution counter of name if counters are
+// enabled. runmu must be locked by the caller.
+func (c *Chain) countName(name string) {
+	if !c.counting {
+		return
+	}
+	count, exists := c.counters[name]
+	if !exists {
+		c.varmu.Lock()
+		if c.counters == nil {
+			c.counters = make(map[string]*int64)
+		}
+		count = new(int64)
+		c.counters[name] = count
+		c.varmu.Unlock()
+	}
+	atomic.AddInt64(count, 1)
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	for i := 0; i < 3; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	stats := c.Stats()
+	if len(stats) != 2 || stats["h1"].CallCount != 3 || stats["h2"].CallCount != 3 {
+		t.Fatal("Stats() failed")
+	}
+	if stats["h1"].TotalDuration <= 0 || stats["h1"].Percentile(50) <= 0 {
+		t.Fatal("Stats() failed")
+	}
+}
+
+func TestStatsRemoved(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	c.Pop()
+	c.Shift()
+	if stats := c.Stats(); len(stats) != 1 || stats["h2"].CallCount != 1 {
+		t.Fatalf("Stats() reported removed handlers: %v", stats)
+	}
+	c.Append("h1", MakeHandler("h1"))
+	if stats := c.Stats(); stats["h1"].CallCount != 0 {
+		t.Fatal("Stats() reused stats of a removed handler")
+	}
+}
+
+func TestCountCalls(t *testing.T) {
+
+	c := New(testkey)
+	if c.CountCalls() != 0 {
+		t.Fatal("CountCalls() failed")
+	}
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	for i := 0; i < 3; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	if c.CountCalls() != 6 {
+		t.Fatal("CountCalls() failed")
+	}
+}
+
+func TestTotalDuration(t *testing.T) {
+
+	c := New(testkey)
+	if c.TotalDuration() != 0 {
+		t.Fatal("TotalDuration() failed")
+	}
+	sleep := func(d time.Duration) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(d)
+		})
+	}
+	c.Append("h1", sleep(2*time.Millisecond))
+	c.Append("h2", sleep(3*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	total := c.TotalDuration()
+	if total < 15*time.Millisecond {
+		t.Fatalf("TotalDuration() failed, got %v", total)
+	}
+	stats := c.Stats()
+	if total != stats["h1"].TotalDuration+stats["h2"].TotalDuration {
+		t.Fatal("TotalDuration() failed")
+	}
+}
+
+func TestResetStats(t *testing.T) {
+
+	c := New(testkey, WithCounters())
+	c.MapErrorFunc(func(error) (int, bool) { return http.StatusTeapot, true })
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	for i := 0; i < 3; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	}
+	if c.CountCalls() != 6 || c.Counts()["h1"] != 3 || c.ErrorStatusCounts()[http.StatusTeapot] != 3 {
+		t.Fatal("ResetStats() failed")
+	}
+	c.ResetStats()
+	if c.CountCalls() != 0 || c.TotalDuration() != 0 || c.WasExecuted() || c.LastRun().Err != nil {
+		t.Fatal("ResetStats() failed")
+	}
+	if len(c.Counts()) != 0 || len(c.ErrorStatusCounts()) != 0 {
+		t.Fatal("ResetStats() failed")
+	}
+	stats := c.Stats()
+	if len(stats) != 2 || stats["h1"].CallCount != 0 || stats["h1"].Percentile(50) != 0 {
+		t.Fatal("ResetStats() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.CountCalls() != 2 || c.Counts()["h2"] != 1 || c.ErrorStatusCounts()[http.StatusTeapot] != 1 {
+		t.Fatal("ResetStats() failed")
+	}
+}
+
+func TestStatsPercentile(t *testing.T) {
+
+	hs := &handlerStats{}
+	for _, i := range rand.Perm(1000) {
+		hs.record(time.Duration(i+1) * time.Millisecond)
+	}
+	stats := hs.snapshot()
+	for p, want := range map[float64]time.Duration{
+		50: 500 * time.Millisecond,
+		95: 950 * time.Millisecond,
+		99: 990 * time.Millisecond,
+	} {
+		got := stats.Percentile(p)
+		if got < want-10*time.Millisecond || got > want+10*time.Millisecond {
+			t.Fatalf("Percentile(%v) failed, got %v, want %v", p, got, want)
+		}
+	}
+	if stats.AverageDuration() != 500500*time.Microsecond {
+		t.Fatal("AverageDuration() failed")
+	}
+
+	// Older samples are replaced by recent ones.
+	for i := 0; i < StatsSamples; i++ {
+		hs.record(time.Second)
+	}
+	if hs.snapshot().Percentile(1) != time.Second {
+		t.Fatal("Percentile() failed")
+	}
+}
+
+// BenchmarkStatsRecord measures the overhead statistics add to execution
+// of every handler. It is expected to stay well under 100ns per op.
+func BenchmarkStatsRecord(b *testing.B) {
+	hs := &handlerStats{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			hs.record(time.Millisecond)
+		}
+	})
+}
+
+func TestCounts(t *testing.T) {
+
+	c := New(testkey, WithCounters())
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatSetsAnError("h2"))
+	c.Append("h3", MakeHandler("h3"))
+	c.Append("h4", MakeHandler("h4"))
+	c.SetEntryPoint("/three", "h3")
+	for i := 0; i < 3; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/three"))
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+
+	counts := c.Counts()
+	if len(counts) != 4 || counts["h1"] != 1 || counts["h2"] != 1 || counts["h3"] != 3 || counts["h4"] != 3 {
+		t.Fatalf("Counts() failed: %v", counts)
+	}
+	if New(testkey).Counts() != nil {
+		t.Fatal("Counts() failed")
+	}
+}
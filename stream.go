@@ -0,0 +1,48 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+)
+
+// DefaultStreamErrorTrailer is the name of the trailer a chain reports a
+// mid-stream error in if WithStreamError is given an empty trailer name.
+const DefaultStreamErrorTrailer = "X-Chain-Error"
+
+// WithStreamError makes the chain report an error set after a handler
+// already started writing the response without buffering or rewriting
+// the response.
+//
+// Once response bytes are written, and possibly flushed to the client,
+// the status code and written body can no longer change. Instead, the
+// error message is sent in a trailer named trailer, or
+// DefaultStreamErrorTrailer if trailer is empty, and hook, if not nil, is
+// called with the request and the error. Trailers are delivered only
+// over HTTP/1.1 chunked and HTTP/2 responses; clients that want them must
+// read the response body to completion.
+//
+// Errors set before anything was written are handled by the error handler
+// set by SetErrorHandler instead.
+func WithStreamError(trailer string, hook func(r *http.Request, err error)) Option {
+	if trailer == "" {
+		trailer = DefaultStreamErrorTrailer
+	}
+	return func(c *Chain) {
+		c.streamtrailer = trailer
+		c.streamhook = hook
+	}
+}
+
+// streamError reports err of a run whose response was already written.
+func (c *Chain) streamError(w http.ResponseWriter, r *http.Request, err error) {
+	if c.streamtrailer == "" {
+		return
+	}
+	w.Header().Set(http.TrailerPrefix+c.streamtrailer, err.Error())
+	if c.streamhook != nil {
+		c.streamhook(r, err)
+	}
+}
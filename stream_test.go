@@ -0,0 +1,72 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamError(t *testing.T) {
+
+	var hooked error
+	handled := false
+	c := New(testkey, WithStreamError("", func(r *http.Request, err error) {
+		hooked = err
+	}))
+	c.SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = true
+	})
+	c.Append("stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk 1\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("chunk 2\n"))
+		c.SetError(errors.New("stream broke"))
+	}))
+	c.Append("after", MakeHandler("after"))
+
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "chunk 1\nchunk 2\n" || resp.StatusCode != http.StatusOK {
+		t.Fatal("WithStreamError() corrupted stream")
+	}
+	if resp.Trailer.Get(DefaultStreamErrorTrailer) != "stream broke" {
+		t.Fatal("WithStreamError() failed to set trailer")
+	}
+	if handled {
+		t.Fatal("error handler called after write")
+	}
+	if hooked == nil || hooked.Error() != "stream broke" {
+		t.Fatal("WithStreamError() failed to call hook")
+	}
+}
+
+func TestStreamErrorNotWritten(t *testing.T) {
+
+	called := false
+	c := New(testkey, WithStreamError("X-Err", func(r *http.Request, err error) {
+		called = true
+	}))
+	c.Append("h1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.SetError(errors.New("failed"))
+	}))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if called || rec.Result().Trailer.Get("X-Err") != "" {
+		t.Fatal("WithStreamError() reported unwritten response")
+	}
+}
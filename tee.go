@@ -0,0 +1,92 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// WithTee makes the chain copy the response body of requests for which
+// selector returns true to a writer returned by sink for that request.
+//
+// Response is copied as it is written, without buffering, and the sink
+// writer is closed once the chain finishes, even if an error occurred.
+// Sink errors do not affect the response sent to the client; after the
+// first failed write nothing more is written to the sink for that request.
+// Sink errors are counted in ChainInfo.TeeErrors.
+func WithTee(selector func(*http.Request) bool, sink func(*http.Request) io.WriteCloser) Option {
+	return func(c *Chain) {
+		c.teesel = selector
+		c.teesink = sink
+	}
+}
+
+// teeWriter is a http.ResponseWriter that copies written data to a sink.
+type teeWriter struct {
+	http.ResponseWriter
+	chain  *Chain
+	sink   io.WriteCloser
+	failed bool
+}
+
+// newTeeWriter returns a new teeWriter that writes to w and sink.
+func (c *Chain) newTeeWriter(w http.ResponseWriter, sink io.WriteCloser) *teeWriter {
+	return &teeWriter{
+		ResponseWriter: w,
+		chain:          c,
+		sink:           sink,
+		failed:         sink == nil,
+	}
+}
+
+// Write implements http.ResponseWriter.Write.
+func (tw *teeWriter) Write(b []byte) (int, error) {
+	n, err := tw.ResponseWriter.Write(b)
+	if n > 0 && !tw.failed {
+		if _, serr := tw.sink.Write(b[:n]); serr != nil {
+			tw.fail()
+		}
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher.Flush if the underlying writer supports it.
+func (tw *teeWriter) Flush() {
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.Hijack if the underlying writer
+// supports it.
+func (tw *teeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := tw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errNotHijacker
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (tw *teeWriter) Unwrap() http.ResponseWriter { return tw.ResponseWriter }
+
+// fail marks the sink as failed and counts the error.
+func (tw *teeWriter) fail() {
+	tw.failed = true
+	atomic.AddUint64(&tw.chain.teeerrs, 1)
+}
+
+// close closes the sink.
+func (tw *teeWriter) close() {
+	if tw.sink == nil {
+		return
+	}
+	if err := tw.sink.Close(); err != nil && !tw.failed {
+		tw.fail()
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testSink struct {
+	bytes.Buffer
+	closed bool
+	err    error
+}
+
+func (ts *testSink) Write(p []byte) (int, error) {
+	if ts.err != nil {
+		return 0, ts.err
+	}
+	return ts.Buffer.Write(p)
+}
+
+func (ts *testSink) Close() error {
+	ts.closed = true
+	return nil
+}
+
+func MakeStreamingHandler(chunks int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			w.Write([]byte(strings.Repeat(string(rune('a'+i%26)), 4096)))
+		}
+	})
+}
+
+func TestTee(t *testing.T) {
+
+	sink := &testSink{}
+	c := New(testkey, WithTee(
+		func(r *http.Request) bool { return r.URL.Path == "/archive" },
+		func(r *http.Request) io.WriteCloser { return sink },
+	))
+	c.Append("stream", MakeStreamingHandler(256))
+	c.Append("error", MakeHandlerThatSetsAnError("error"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/skip"))
+	if sink.Len() != 0 || sink.closed {
+		t.Fatal("TestTee() failed")
+	}
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/archive"))
+	if rec.Body.Len() < 256*4096 || !bytes.Equal(rec.Body.Bytes(), sink.Bytes()) {
+		t.Fatal("TestTee() failed")
+	}
+	if !sink.closed {
+		t.Fatal("TestTee() failed")
+	}
+	if c.info("").TeeErrors != 0 {
+		t.Fatal("TestTee() failed")
+	}
+}
+
+func TestTeeSinkError(t *testing.T) {
+
+	sink := &testSink{err: errors.New("sink failure")}
+	c := New(testkey, WithTee(
+		func(r *http.Request) bool { return true },
+		func(r *http.Request) io.WriteCloser { return sink },
+	))
+	c.Append("stream", MakeStreamingHandler(16))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if rec.Body.Len() != 16*4096 {
+		t.Fatal("TestTeeSinkError() failed")
+	}
+	if c.info("").TeeErrors != 1 {
+		t.Fatal("TestTeeSinkError() failed")
+	}
+}
+
+// hijackRecorder is a httptest.ResponseRecorder that implements
+// http.Hijacker.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (hr *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hr.hijacked = true
+	return nil, nil, nil
+}
+
+func TestTeeWriterInterfaces(t *testing.T) {
+
+	c := New(testkey, WithTee(
+		func(r *http.Request) bool { return true },
+		func(r *http.Request) io.WriteCloser { return &testSink{} },
+	))
+	var hijackErr, flushErr error
+	c.Append("upgrade", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		flushErr = rc.Flush()
+		_, _, hijackErr = rc.Hijack()
+	}))
+	rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c.ServeHTTP(rec, MakeRequest("/"))
+	if hijackErr != nil || !rec.hijacked {
+		t.Fatal("teeWriter failed to hijack")
+	}
+	if flushErr != nil || !rec.Flushed {
+		t.Fatal("teeWriter failed to flush")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AppendThrottled appends a handler to the chain under a specified name
+// like Append but the handler is executed at most once per interval every:
+// by the first request served after the interval since its last execution
+// elapsed, as measured by the chain clock set by WithClock. Other requests
+// skip the handler and continue with the next one.
+//
+// An error set by a throttled execution stops that run as usual but does
+// not affect future intervals. The interval is shared by clones of the
+// chain, which makes it suitable for side work such as refreshing a
+// configuration snapshot.
+func (c *Chain) AppendThrottled(name string, h http.Handler, every time.Duration) error {
+	return c.Append(name, &throttledHandler{chain: c, handler: h, every: every})
+}
+
+// throttledHandler executes a handler at most once per interval.
+type throttledHandler struct {
+	chain   *Chain
+	handler http.Handler
+	every   time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// ServeHTTP implements http.Handler.
+func (th *throttledHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	th.mu.Lock()
+	now := th.chain.now()
+	if now.Before(th.next) {
+		th.mu.Unlock()
+		return
+	}
+	th.next = now.Add(th.every)
+	th.mu.Unlock()
+
+	th.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestAppendThrottled(t *testing.T) {
+
+	var calls, after int32
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	template := New(testkey, WithClock(clock.Now))
+	template.AppendThrottled("heartbeat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}), time.Minute)
+	template.Append("after", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&after, 1)
+	}))
+
+	serve := func(n int) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(c *Chain) {
+				defer wg.Done()
+				c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+			}(template.Clone())
+		}
+		wg.Wait()
+	}
+
+	for interval := int32(1); interval <= 3; interval++ {
+		serve(16)
+		if atomic.LoadInt32(&calls) != interval {
+			t.Fatalf("AppendThrottled() failed: %d calls in %d intervals", calls, interval)
+		}
+		clock.Advance(30 * time.Second)
+		serve(4)
+		if atomic.LoadInt32(&calls) != interval {
+			t.Fatal("AppendThrottled() executed within interval")
+		}
+		clock.Advance(30 * time.Second)
+	}
+	if atomic.LoadInt32(&after) != 60 {
+		t.Fatal("AppendThrottled() blocked following handlers")
+	}
+}
+
+func TestAppendThrottledError(t *testing.T) {
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := New(testkey, WithClock(clock.Now))
+	c.AppendThrottled("fails", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.SetError(errors.New("refresh failed"))
+	}), time.Minute)
+	c.Append("h1", MakeHandler("h1"))
+
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastError() == nil {
+		t.Fatal("AppendThrottled() failed")
+	}
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastError() != nil {
+		t.Fatal("AppendThrottled() failed")
+	}
+	clock.Advance(time.Minute)
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastError() == nil {
+		t.Fatal("AppendThrottled() failed")
+	}
+}
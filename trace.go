@@ -0,0 +1,145 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+)
+
+// DefaultTraceLimit is the default maximum number of entries recorded in a
+// trace of a single ServeHTTP call.
+const DefaultTraceLimit = 1024
+
+// RunResult describes the last ServeHTTP call of a chain.
+type RunResult struct {
+	// Trace are the names of handlers in order as they were executed.
+	// If the trace limit was exceeded the last entry is a truncation marker.
+	Trace []string
+	// Truncated is the number of trace entries that were dropped because
+	// the trace limit was exceeded.
+	Truncated int
+	// Err is the error the run finished with, if any.
+	Err error
+	// Sampled is true if observability data was collected for the run.
+	// See WithObservabilitySampling.
+	Sampled bool
+	// Status is the status code Err was mapped to by error mappings
+	// registered with MapError or 0 if the run succeeded or no mappings
+	// were registered.
+	Status int
+}
+
+// WithTraceLimit sets the maximum number of entries recorded in a trace of
+// a single ServeHTTP call. Entries over the limit are counted and replaced
+// by a single truncation marker at the end of the trace.
+// A limit less than 1 disables tracing.
+func WithTraceLimit(n int) Option {
+	return func(c *Chain) { c.tracelimit = n }
+}
+
+// WithObservabilitySampling sets a function that decides per run whether
+// observability data is collected for it. For runs for which fn returns
+// false no trace is recorded, Observer methods are not called and handler
+// execution durations are neither measured nor reported to Stats and
+// Metrics, while counters set by WithCounters, Metrics request and error
+// counts and link hooks remain unaffected. If fn is nil, which is the
+// default, every run is sampled.
+func WithObservabilitySampling(fn func(*http.Request) bool) Option {
+	return func(c *Chain) { c.sampler = fn }
+}
+
+// SampleRate returns a Predicate for WithObservabilitySampling that
+// samples approximately rate, 0 <= rate <= 1, of runs.
+func SampleRate(rate float64) Predicate {
+	return func(*http.Request) bool { return rand.Float64() < rate }
+}
+
+// LastRun returns the RunResult of the last ServeHTTP call.
+func (c *Chain) LastRun() RunResult {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	trace := make([]string, len(c.trace))
+	copy(trace, c.trace)
+	return RunResult{
+		Trace:     trace,
+		Truncated: c.dropped,
+		Err:       c.err,
+		Sampled:   c.sampled,
+		Status:    c.status,
+	}
+}
+
+// Jumps returns the MoveTo transitions made during the last ServeHTTP
+// call, in order as they were made, as pairs of names of the handler that
+// called MoveTo and the handler execution continued on.
+func (c *Chain) Jumps() [][2]string {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	jumps := make([][2]string, len(c.jumps))
+	copy(jumps, c.jumps)
+	return jumps
+}
+
+// traceLink records the execution of link at index i.
+func (c *Chain) traceLink(i int) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if i >= len(c.indexes) || c.tracelimit < 1 {
+		return
+	}
+	if len(c.trace) >= c.tracelimit {
+		c.dropped++
+		return
+	}
+	c.trace = append(c.trace, c.indexes[i])
+}
+
+// finishTrace appends a truncation marker if entries were dropped.
+// varmu must be locked by the caller.
+func (c *Chain) finishTrace() {
+	if c.dropped > 0 {
+		c.trace = append(c.trace, fmt.Sprintf("…truncated (%d more)", c.dropped))
+	}
+}
+
+// annotateTrace replaces the trace entry of the currently executing link
+// with entry. It does nothing if the entry was not recorded.
+func (c *Chain) annotateTrace(entry string) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if c.dropped > 0 || len(c.trace) == 0 {
+		return
+	}
+	c.trace[len(c.trace)-1] = entry
+}
+
+// traceEntry returns the index of the trace entry of the currently
+// executing link or -1 if the entry was not recorded.
+func (c *Chain) traceEntry() int {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if c.dropped > 0 {
+		return -1
+	}
+	return len(c.trace) - 1
+}
+
+// annotateTraceAt replaces the trace entry at index i, as returned by
+// traceEntry, with entry. It does nothing if i is -1.
+func (c *Chain) annotateTraceAt(i int, entry string) {
+	c.varmu.Lock()
+	defer c.varmu.Unlock()
+
+	if i >= 0 && i < len(c.trace) {
+		c.trace[i] = entry
+	}
+}
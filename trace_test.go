@@ -0,0 +1,120 @@
+// Copyright 2019 Vedran Vuk. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package chainer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	run := c.LastRun()
+	if len(run.Trace) != 2 || run.Trace[0] != "h1" || run.Trace[1] != "h2" || run.Truncated != 0 {
+		t.Fatal("TestTrace() failed")
+	}
+}
+
+func TestJumps(t *testing.T) {
+
+	c := New(testkey)
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandlerThatMovesToAHandler("h2", "h4", t))
+	c.Append("h3", MakeHandler("h3"))
+	c.Append("h4", MakeHandler("h4"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	jumps := c.Jumps()
+	if len(jumps) != 1 || jumps[0] != [2]string{"h2", "h4"} {
+		t.Fatalf("Jumps() failed: %v", jumps)
+	}
+
+	c.Reset()
+	if len(c.Jumps()) != 0 {
+		t.Fatal("Jumps() failed")
+	}
+}
+
+func TestTraceLimit(t *testing.T) {
+
+	const loops = 100
+
+	count := 0
+	c := New(testkey, WithTraceLimit(10))
+	c.Append("loop", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count++; count < loops {
+			chain, _ := Unpack(r, testkey)
+			chain.MoveTo("loop")
+		}
+	}))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	run := c.LastRun()
+	if run.Truncated != loops-10 {
+		t.Fatal("TestTraceLimit() failed")
+	}
+	if len(run.Trace) != 11 || run.Trace[10] != "…truncated (90 more)" {
+		t.Fatal("TestTraceLimit() failed")
+	}
+}
+
+func TestObservabilitySampling(t *testing.T) {
+
+	obs := &testObserver{}
+	c := New(testkey, WithObserver(obs), WithCounters(), WithObservabilitySampling(func(r *http.Request) bool {
+		return r.URL.Path == "/sampled"
+	}))
+	c.Append("h1", MakeHandler("h1"))
+	c.Append("h2", MakeHandler("h2"))
+
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	run := c.LastRun()
+	if run.Sampled || len(run.Trace) != 0 || len(obs.events) != 0 || c.Stats()["h1"].CallCount != 0 {
+		t.Fatal("WithObservabilitySampling() failed")
+	}
+	if c.Counts()["h1"] != 1 {
+		t.Fatal("WithObservabilitySampling() failed to count")
+	}
+
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/sampled"))
+	run = c.LastRun()
+	if !run.Sampled || len(run.Trace) != 2 || run.Trace[0] != "h1" || run.Trace[1] != "h2" {
+		t.Fatal("WithObservabilitySampling() failed")
+	}
+	if len(obs.events) != 5 || c.Stats()["h2"].CallCount != 1 {
+		t.Fatal("WithObservabilitySampling() failed")
+	}
+
+	c = New(testkey, WithObservabilitySampling(SampleRate(0)))
+	c.Append("h1", MakeHandler("h1"))
+	c.ServeHTTP(httptest.NewRecorder(), MakeRequest("/"))
+	if c.LastRun().Sampled {
+		t.Fatal("SampleRate() failed")
+	}
+}
+
+func benchmarkObservability(b *testing.B, options ...Option) {
+	c := New(testkey, options...)
+	for i := 0; i < 10; i++ {
+		c.Append(fmt.Sprintf("h%d", i), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	}
+	w, r := httptest.NewRecorder(), MakeRequest("/")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkObservabilitySampled(b *testing.B) {
+	benchmarkObservability(b)
+}
+
+func BenchmarkObservabilityUnsampled(b *testing.B) {
+	benchmarkObservability(b, WithObservabilitySampling(SampleRate(0)))
+}